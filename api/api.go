@@ -1,14 +1,30 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"strconv"
+	"sync"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/apikey"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/attachment"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/draft"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/extract"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/health"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/idempotency"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/qr"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/queue"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/transactions"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/upload"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/zap"
@@ -16,34 +32,149 @@ import (
 
 type Server struct {
 	*echo.Echo
+	jobs   *queue.Queue
+	keys   *idempotency.Keys
+	logger *zap.Logger
+}
+
+// Work runs the background job workers and the purge of expired idempotency
+// keys until ctx is cancelled and the jobs being run have finished.
+func (s *Server) Work(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.keys.Run(ctx, s.logger)
+	}()
+	s.jobs.Run(ctx)
+	wg.Wait()
 }
 
 func New(db *sql.DB, cfg config.Config, logger *zap.Logger) *Server {
 	e := echo.New()
+	e.Validator = validate.New()
+	e.HTTPErrorHandler = problem.ErrorHandler
+	// client addresses scope idempotency keys, X-Forwarded-For and X-Real-IP
+	// are set by clients too and not trusted
+	e.IPExtractor = echo.ExtractIPDirect()
 
 	e.Use(middleware.Logger())
 	e.Use(mlog.Middleware(logger))
 
+	keys, err := auth.NewKeys(cfg.Auth)
+	if err != nil {
+		logger.Fatal("invalid auth config", zap.Error(err))
+	}
+
+	if !spender.ValidDeletePolicy(cfg.FeatureFlag.SpenderDeletePolicy) {
+		logger.Fatal("invalid spender delete policy", zap.String("policy", cfg.FeatureFlag.SpenderDeletePolicy))
+	}
+
 	v1 := e.Group("/api/v1")
 
 	v1.GET("/slow", health.Slow)
 	v1.GET("/health", health.Check(db))
-	v1.POST("/upload", eslip.Upload)
+	v1.POST("/auth/token", auth.New(keys, db).Token)
+
+	// Policies: every group below requires a bearer token, spenders only
+	// reach their own data while admins reach everyone's.
+	apiKeys := apikey.New(db)
+	authn := auth.Middleware(keys, apiKeys)
+	users := auth.Require(auth.RoleAdmin, auth.RoleSpender)
+	admins := auth.Require(auth.RoleAdmin)
+
+	// writes clients retry may carry an Idempotency-Key header
+	retries := idempotency.New(db, cfg.Idempotency)
+	idem := retries.Middleware(cfg.Upload.MaxRequestSize)
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("invalid storage config", zap.Error(err))
+	}
+	ex, err := extract.New(cfg.Extract)
+	if err != nil {
+		logger.Fatal("invalid extract config", zap.Error(err))
+	}
+	qrr, err := qr.New(cfg.Extract)
+	if err != nil {
+		logger.Fatal("invalid qr config", zap.Error(err))
+	}
+	drafts := draft.New(db, ex, qrr)
+
+	// uploaded slips are stored right away and processed by the job workers
+	jobs := queue.New(db, cfg.Queue, logger)
+	progress := upload.New(db, jobs, store, drafts)
+	jobs.Handle(upload.KindProcess, progress.Work)
+
+	uploads := eslip.New(cfg.Upload, store, progress)
+	v1.POST("/upload", uploads.Upload, authn, users, idem)
+	v1.GET("/uploads/:id", progress.GetByID, authn, users)
+
+	{
+		g := v1.Group("/drafts", authn, users)
+		g.GET("/:id", drafts.GetByID)
+		g.POST("/:id/confirm", drafts.Confirm)
+	}
 
 	{
 		h := spender.New(cfg.FeatureFlag, db)
-		v1.GET("/spenders", h.GetAll)
-		v1.POST("/spenders", h.Create)
-		v1.GET("/spenders/:id/transactions", h.SpenderTransactionById)
-		v1.GET("/spenders/:id/transactions/summary", h.SpenderTransactionByIdSummary)
+		v1.POST("/spenders", h.Create, idem)
+		// services, such as the receipt extractor, may look spenders up by email
+		v1.GET("/spenders", h.GetAll, authn, auth.Require(auth.RoleAdmin, auth.RoleService), auth.RequireScope(auth.ScopeSpendersRead))
+
+		g := v1.Group("/spenders", authn, users)
+		g.GET("/:id", h.GetByID, auth.OwnSpender("id"))
+		g.PUT("/:id", h.Update, auth.OwnSpender("id"))
+		g.PATCH("/:id", h.Patch, auth.OwnSpender("id"))
+		g.DELETE("/:id", h.Delete, admins)
+		g.GET("/:id/transactions", h.SpenderTransactionById, auth.OwnSpender("id"))
+		g.GET("/:id/transactions/summary", h.SpenderTransactionByIdSummary, auth.OwnSpender("id"))
+		g.GET("/:id/transactions/summary/categories", h.SpenderTransactionByIdCategories, auth.OwnSpender("id"))
+		g.GET("/:id/transactions/summary/periods", h.SpenderTransactionByIdPeriods, auth.OwnSpender("id"))
 	}
 
 	{
 		h := transactions.New(cfg.FeatureFlag, db)
-		v1.GET("/transactions", h.GetAll)
-		v1.POST("/transactions", h.Create)
-		v1.PUT("/transactions/:id", h.Update)
+		// services, such as the receipt extractor, may only record transactions
+		v1.POST("/transactions", h.Create, authn, auth.Require(auth.RoleAdmin, auth.RoleSpender, auth.RoleService), auth.RequireScope(auth.ScopeTransactionsCreate), idem)
+
+		g := v1.Group("/transactions", authn, users)
+		g.GET("", h.GetAll)
+		g.GET("/duplicates", h.Duplicates, admins)
+		g.GET("/:id", h.GetByID)
+		g.PUT("/:id", h.Update)
+		g.PATCH("/:id", h.Patch)
+		g.DELETE("/:id", h.Delete)
+
+		a := attachment.New(db, store, uploads)
+		g.GET("/:id/attachments", a.GetAll)
+		g.POST("/:id/attachments", a.Attach, middleware.BodyLimit(strconv.FormatInt(cfg.Upload.MaxRequestSize, 10)))
+		g.DELETE("/:id/attachments/:attachment", a.Detach)
+		g.GET("/:id/attachments/:attachment/file", a.File)
+	}
+
+	{
+		h := transactions.New(cfg.FeatureFlag, db)
+		v1.GET("/expenses/summary", h.ExpenseSummary, authn, users)
+		v1.GET("/incomes/summary", h.IncomeSummary, authn, users)
+		v1.GET("/balance", h.Balance, authn, users)
+	}
+
+	{
+		h := exchange.New(db)
+		g := v1.Group("/exchange-rates", authn, users)
+		g.GET("", h.GetAll)
+		g.PUT("", h.Upsert, admins)
+		g.POST("/import", h.Import, admins)
+	}
+
+	{
+		g := v1.Group("/api-keys", authn, admins)
+		g.GET("", apiKeys.GetAll)
+		g.POST("", apiKeys.Create)
+		g.DELETE("/:id", apiKeys.Revoke)
+		g.POST("/:id/rotate", apiKeys.Rotate)
 	}
 
-	return &Server{e}
+	return &Server{e, jobs, retries, logger}
 }
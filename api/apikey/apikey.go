@@ -0,0 +1,257 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Key is a service credential as listed to admins, it never carries the
+// secret.
+type Key struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name" validate:"required,max=100"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes" validate:"required"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Minted is returned once when a key is created or rotated, only the hash of
+// Secret is stored.
+type Minted struct {
+	Key
+	Secret string `json:"key"`
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db}
+}
+
+const (
+	cStmt = `INSERT INTO api_key (name, prefix, hash, scopes) VALUES ($1, $2, $3, $4) RETURNING id, created_at;`
+	lStmt = `SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at FROM api_key ORDER BY id`
+	gStmt = `SELECT name, scopes FROM api_key WHERE id = $1 AND revoked_at IS NULL FOR UPDATE`
+	rStmt = `UPDATE api_key SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL;`
+	vStmt = `SELECT id, hash, scopes FROM api_key WHERE prefix = $1 AND revoked_at IS NULL`
+	tStmt = `UPDATE api_key SET last_used_at = now() WHERE id = $1;`
+)
+
+// Keys look like hj_<prefix>_<secret>. The prefix is stored in clear to find
+// the key, the whole key is only stored as a SHA-256 hash; its 256 random
+// bits make a slow password hash unnecessary.
+const keyPrefix = "hj_"
+
+func generate() (prefix, secret string, err error) {
+	b := make([]byte, 5+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = strings.ToLower(base32.StdEncoding.EncodeToString(b[:5]))
+	return prefix, keyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[5:]), nil
+}
+
+func parse(key string) (prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	return prefix, ok && len(prefix) == 8 && secret != ""
+}
+
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyKey implements auth.KeyVerifier and records when the key was used.
+func (h handler) VerifyKey(ctx context.Context, key string) (auth.Identity, error) {
+	prefix, ok := parse(key)
+	if !ok {
+		return auth.Identity{}, fmt.Errorf("%w: malformed", auth.ErrInvalidKey)
+	}
+
+	var id int64
+	var stored string
+	var scopes []string
+	err := h.db.QueryRowContext(ctx, vStmt, prefix).Scan(&id, &stored, pq.Array(&scopes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Identity{}, fmt.Errorf("%w: unknown prefix %s", auth.ErrInvalidKey, prefix)
+	}
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(hash(key))) != 1 {
+		return auth.Identity{}, fmt.Errorf("%w: secret mismatch for %s", auth.ErrInvalidKey, prefix)
+	}
+
+	if _, err := h.db.ExecContext(ctx, tStmt, id); err != nil {
+		return auth.Identity{}, err
+	}
+	return auth.Identity{Role: auth.RoleService, Scopes: scopes, KeyID: id}, nil
+}
+
+func (h handler) GetAll(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	rows, err := h.db.QueryContext(ctx, lStmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		var k Key
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// Create mints a key, the response is the only time its secret is shown.
+func (h handler) Create(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var k Key
+	if err := c.Bind(&k); err != nil {
+		return problem.BadRequest(err)
+	}
+	if err := c.Validate(k); err != nil {
+		return err
+	}
+	if err := checkScopes(k.Scopes); err != nil {
+		return problem.BadRequest(err)
+	}
+
+	m, err := mint(ctx, h.db, k.Name, k.Scopes)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("api key minted", zap.Int64("id", m.ID), zap.String("prefix", m.Prefix))
+	return c.JSON(http.StatusCreated, m)
+}
+
+// Revoke stops a key from authenticating, revoked keys stay listed.
+func (h handler) Revoke(c echo.Context) error {
+	logger := mlog.L(c)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	result, err := h.db.ExecContext(c.Request().Context(), rStmt, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return problem.NotFound("api key not found or already revoked")
+	}
+
+	logger.Info("api key revoked", zap.Int64("id", id))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Rotate revokes a key and mints its replacement with the same name and
+// scopes in one database transaction.
+func (h handler) Rotate(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	var scopes []string
+	err = tx.QueryRowContext(ctx, gStmt, id).Scan(&name, pq.Array(&scopes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("api key not found or already revoked")
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, rStmt, id); err != nil {
+		return err
+	}
+	m, err := mint(ctx, tx, name, scopes)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logger.Info("api key rotated", zap.Int64("id", id), zap.Int64("replacement", m.ID))
+	return c.JSON(http.StatusCreated, m)
+}
+
+func checkScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("scopes must not be empty")
+	}
+	for _, s := range scopes {
+		if !auth.ValidScope(s) {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func mint(ctx context.Context, q queryer, name string, scopes []string) (Minted, error) {
+	prefix, secret, err := generate()
+	if err != nil {
+		return Minted{}, err
+	}
+
+	m := Minted{Key: Key{Name: name, Prefix: prefix, Scopes: scopes}, Secret: secret}
+	err = q.QueryRowContext(ctx, cStmt, name, prefix, hash(secret), pq.Array(scopes)).Scan(&m.ID, &m.CreatedAt)
+	return m, err
+}
@@ -0,0 +1,231 @@
+package apikey
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// capture records the value of a statement argument.
+type capture struct{ v *string }
+
+func (c capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.v = s
+	return ok
+}
+
+func newContext(method, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validate.New()
+	req := httptest.NewRequest(method, "/api-keys", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestGenerate(t *testing.T) {
+	prefix, secret, err := generate()
+
+	assert.NoError(t, err)
+	assert.Len(t, prefix, 8)
+	assert.True(t, strings.HasPrefix(secret, "hj_"+prefix+"_"))
+
+	got, ok := parse(secret)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, got)
+}
+
+func TestVerifyKey(t *testing.T) {
+	const key = "hj_abcdefgh_s3cret"
+
+	t.Run("resolve key to service identity and track its use", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(vStmt).WithArgs("abcdefgh").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hash", "scopes"}).AddRow(3, hash(key), "{transactions:create}"))
+		mock.ExpectExec(tStmt).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		id, err := New(db).VerifyKey(context.Background(), key)
+
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Identity{Role: auth.RoleService, Scopes: []string{"transactions:create"}, KeyID: 3}, id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject wrong secret", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(vStmt).WithArgs("abcdefgh").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hash", "scopes"}).AddRow(3, hash("hj_abcdefgh_other"), "{}"))
+
+		_, err := New(db).VerifyKey(context.Background(), key)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidKey)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject unknown or revoked prefix", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(vStmt).WithArgs("abcdefgh").WillReturnRows(sqlmock.NewRows([]string{"id", "hash", "scopes"}))
+
+		_, err := New(db).VerifyKey(context.Background(), key)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	})
+
+	t.Run("reject malformed key", func(t *testing.T) {
+		_, err := New(nil).VerifyKey(context.Background(), "not-a-key")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	})
+}
+
+func TestCreateKey(t *testing.T) {
+	t.Run("mint key and store only its hash", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"name": "textract", "scopes": ["transactions:create"]}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		var prefix, stored string
+		mock.ExpectQuery(cStmt).WithArgs("textract", capture{&prefix}, capture{&stored}, "{\"transactions:create\"}").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+
+		err := New(db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var m Minted
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m))
+		assert.Equal(t, int64(1), m.ID)
+		assert.Equal(t, prefix, m.Prefix)
+		assert.Equal(t, hash(m.Secret), stored)
+		assert.NotContains(t, stored, m.Secret)
+	})
+
+	invalid := map[string]string{
+		"unknown scope":  `{"name": "textract", "scopes": ["everything"]}`,
+		"no scopes":      `{"name": "textract", "scopes": []}`,
+		"missing name":   `{"scopes": ["transactions:create"]}`,
+		"malformed body": `{ bad }`,
+	}
+	for name, body := range invalid {
+		t.Run("reject "+name, func(t *testing.T) {
+			c, _ := newContext(http.MethodPost, body)
+
+			err := New(nil).Create(c)
+
+			assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		})
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	t.Run("revoke active key", func(t *testing.T) {
+		c, rec := newContext(http.MethodDelete, "")
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(rStmt).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(db).Revoke(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("revoke unknown key", func(t *testing.T) {
+		c, _ := newContext(http.MethodDelete, "")
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(rStmt).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := New(db).Revoke(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	t.Run("replace key with the same name and scopes", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, "")
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt).WithArgs(int64(3)).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "scopes"}).AddRow("textract", "{transactions:create}"))
+		mock.ExpectExec(rStmt).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(cStmt).WithArgs("textract", sqlmock.AnyArg(), sqlmock.AnyArg(), "{\"transactions:create\"}").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, time.Now()))
+		mock.ExpectCommit()
+
+		err := New(db).Rotate(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"id":4`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rotate revoked key", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "")
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt).WithArgs(int64(3)).WillReturnRows(sqlmock.NewRows([]string{"name", "scopes"}))
+		mock.ExpectRollback()
+
+		err := New(db).Rotate(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetAllKeys(t *testing.T) {
+	c, rec := newContext(http.MethodGet, "")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(lStmt).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_at", "last_used_at", "revoked_at"}).
+		AddRow(3, "textract", "abcdefgh", "{transactions:create}", created, created, nil))
+
+	err := New(db).GetAll(c)
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"id": 3,
+		"name": "textract",
+		"prefix": "abcdefgh",
+		"scopes": ["transactions:create"],
+		"created_at": "2024-05-01T00:00:00Z",
+		"last_used_at": "2024-05-01T00:00:00Z",
+		"revoked_at": null
+	}]`, rec.Body.String())
+}
@@ -0,0 +1,296 @@
+package attachment
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Attachment is a stored slip linked to a transaction.
+type Attachment struct {
+	ID            int64     `json:"id"`
+	TransactionID int64     `json:"transaction_id"`
+	Key           string    `json:"key" validate:"required"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	UploadedAt    time.Time `json:"uploaded_at"`
+}
+
+// Saver validates and stores an uploaded file, as eslip does for /upload.
+type Saver interface {
+	Save(ctx context.Context, file *multipart.FileHeader) (eslip.Result, error)
+}
+
+type handler struct {
+	db    *sql.DB
+	store storage.BlobStore
+	saver Saver
+}
+
+func New(db *sql.DB, store storage.BlobStore, saver Saver) *handler {
+	return &handler{db, store, saver}
+}
+
+const (
+	oStmt = `SELECT spender_id FROM transaction WHERE id = $1`
+	cStmt = `INSERT INTO attachment (transaction_id, storage_key, content_type, size, sha256) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (transaction_id, sha256) DO NOTHING RETURNING id, uploaded_at;`
+	lStmt = `SELECT id, transaction_id, storage_key, content_type, size, sha256, uploaded_at FROM attachment`
+	tStmt = lStmt + ` WHERE transaction_id = $1 ORDER BY id`
+	gStmt = lStmt + ` WHERE id = $1 AND transaction_id = $2`
+	dStmt = `DELETE FROM attachment WHERE id = $1 AND transaction_id = $2;`
+
+	// uStmt tells whether spender $2 stored the slip $1, through /upload or
+	// as an attachment of one of their transactions.
+	uStmt = `SELECT EXISTS (SELECT 1 FROM upload WHERE storage_key = $1 AND spender_id = $2)
+	OR EXISTS (SELECT 1 FROM attachment a JOIN transaction t ON t.id = a.transaction_id WHERE a.storage_key = $1 AND t.spender_id = $2)`
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttachment(row scanner, a *Attachment) error {
+	return row.Scan(&a.ID, &a.TransactionID, &a.Key, &a.ContentType, &a.Size, &a.SHA256, &a.UploadedAt)
+}
+
+var errNotFound = problem.NotFound("attachment not found")
+
+// transaction returns the transaction of the :id parameter. Transactions of
+// another spender are reported as not found, as GetByID of transactions does.
+func (h handler) transaction(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, problem.BadRequest(err)
+	}
+	identity, ok := auth.FromContext(c)
+	if !ok {
+		return 0, problem.Unauthorized("missing identity")
+	}
+
+	var spender sql.NullInt64
+	err = h.db.QueryRowContext(c.Request().Context(), oStmt, id).Scan(&spender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, problem.NotFound("transaction not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if own := identity.SpenderScope(); own != nil && (!spender.Valid || spender.Int64 != *own) {
+		return 0, problem.NotFound("transaction not found")
+	}
+	return id, nil
+}
+
+func (h handler) GetAll(c echo.Context) error {
+	tid, err := h.transaction(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := h.db.QueryContext(c.Request().Context(), tStmt, tid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	as := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return err
+		}
+		as = append(as, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, as)
+}
+
+// Attach links a slip to the transaction. A multipart request uploads the
+// "file" field first; a JSON request links a slip already uploaded through
+// /upload by the key it was stored under.
+func (h handler) Attach(c echo.Context) error {
+	logger := mlog.L(c)
+	tid, err := h.transaction(c)
+	if err != nil {
+		return err
+	}
+
+	var a Attachment
+	ct := c.Request().Header.Get(echo.HeaderContentType)
+	switch {
+	case strings.HasPrefix(ct, echo.MIMEMultipartForm):
+		a, err = h.upload(c)
+	case strings.HasPrefix(ct, echo.MIMEApplicationJSON):
+		a, err = h.link(c)
+	default:
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+echo.MIMEMultipartForm+" or "+echo.MIMEApplicationJSON)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.TransactionID = tid
+	err = h.db.QueryRowContext(c.Request().Context(), cStmt, a.TransactionID, a.Key, a.ContentType, a.Size, a.SHA256).Scan(&a.ID, &a.UploadedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.Conflict("slip is already attached to this transaction")
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("slip attached", zap.Int64("transaction_id", tid), zap.Int64("id", a.ID), zap.String("key", a.Key))
+	return c.JSON(http.StatusCreated, a)
+}
+
+func (h handler) upload(c echo.Context) (Attachment, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return Attachment{}, problem.BadRequest(fmt.Errorf("missing file: %w", err))
+	}
+
+	res, err := h.saver.Save(c.Request().Context(), file)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("save %s: %w", file.Filename, err)
+	}
+	if res.Status != eslip.StatusUploaded {
+		return Attachment{}, problem.BadRequest(errors.New(res.Error))
+	}
+	return Attachment{Key: res.Key, ContentType: res.ContentType, Size: res.Size, SHA256: res.SHA256}, nil
+}
+
+// link reads the stored slip back to make sure it exists and still matches
+// the hash its key was derived from. Spenders may only link slips they
+// stored themselves, others' are reported as never uploaded.
+func (h handler) link(c echo.Context) (Attachment, error) {
+	ctx := c.Request().Context()
+	identity, ok := auth.FromContext(c)
+	if !ok {
+		return Attachment{}, problem.Unauthorized("missing identity")
+	}
+
+	var a Attachment
+	if err := c.Bind(&a); err != nil {
+		return a, problem.BadRequest(err)
+	}
+	if err := c.Validate(a); err != nil {
+		return a, err
+	}
+	sum, contentType, ok := eslip.ParseKey(a.Key)
+	if !ok {
+		return a, problem.BadRequest(fmt.Errorf("%q is not a key returned by upload", a.Key))
+	}
+
+	errNeverUploaded := problem.Unprocessable(fmt.Errorf("slip %s was never uploaded", a.Key))
+	if own := identity.SpenderScope(); own != nil {
+		var stored bool
+		if err := h.db.QueryRowContext(ctx, uStmt, a.Key, *own).Scan(&stored); err != nil {
+			return a, err
+		}
+		if !stored {
+			return a, errNeverUploaded
+		}
+	}
+
+	r, err := h.store.Get(ctx, a.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return a, errNeverUploaded
+	}
+	if err != nil {
+		return a, err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return a, err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != sum {
+		return a, fmt.Errorf("stored slip %s does not match its hash", a.Key)
+	}
+
+	return Attachment{Key: a.Key, ContentType: contentType, Size: size, SHA256: sum}, nil
+}
+
+// Detach unlinks a slip. The stored file is kept since content addressed
+// keys may be shared with other transactions.
+func (h handler) Detach(c echo.Context) error {
+	logger := mlog.L(c)
+	tid, err := h.transaction(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("attachment"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	result, err := h.db.ExecContext(c.Request().Context(), dStmt, id, tid)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errNotFound
+	}
+
+	logger.Info("slip detached", zap.Int64("transaction_id", tid), zap.Int64("id", id))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// File streams the stored slip back with the content type it was sniffed as.
+func (h handler) File(c echo.Context) error {
+	ctx := c.Request().Context()
+	tid, err := h.transaction(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("attachment"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	var a Attachment
+	err = scanAttachment(h.db.QueryRowContext(ctx, gStmt, id, tid), &a)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	r, err := h.store.Get(ctx, a.Key)
+	if err != nil {
+		return fmt.Errorf("read attachment %d: %w", a.ID, err)
+	}
+	defer r.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(a.Size, 10))
+	header.Set("ETag", `"`+a.SHA256+`"`)
+	return c.Stream(http.StatusOK, a.ContentType, r)
+}
@@ -0,0 +1,287 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const png = "\x89PNG\r\n\x1a\n slip"
+
+var (
+	spender    = auth.Identity{SpenderID: 1, Role: auth.RoleSpender}
+	uploadedAt = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	columns    = []string{"id", "transaction_id", "storage_key", "content_type", "size", "sha256", "uploaded_at"}
+)
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newContext(req *http.Request, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validate.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames([]string{"id", "attachment"}[:len(params)]...)
+	c.SetParamValues(params...)
+	auth.SetIdentity(c, spender)
+	return c, rec
+}
+
+func newStore(t *testing.T) storage.BlobStore {
+	store, err := storage.NewLocal(t.TempDir())
+	assert.NoError(t, err)
+	return store
+}
+
+func expectOwner(mock sqlmock.Sqlmock, spender any) {
+	mock.ExpectQuery(oStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(spender))
+}
+
+func expectStored(mock sqlmock.Sqlmock, key any, stored bool) {
+	mock.ExpectQuery(uStmt).WithArgs(key, int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(stored))
+}
+
+func TestAttach(t *testing.T) {
+	key := "eslips/" + sha(png) + ".png"
+
+	t.Run("upload and attach a slip", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		part, _ := w.CreateFormFile("file", "slip.png")
+		part.Write([]byte(png))
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+		c, rec := newContext(req, "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		mock.ExpectQuery(cStmt).WithArgs(int64(7), key, "image/png", int64(len(png)), sha(png)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "uploaded_at"}).AddRow(3, uploadedAt))
+
+		store := newStore(t)
+		err := New(db, store, eslip.New(config.Upload{MaxFileSize: 1 << 10, MaxRequestSize: 1 << 20}, store, nil)).Attach(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 3,
+			"transaction_id": 7,
+			"key": "`+key+`",
+			"content_type": "image/png",
+			"size": 13,
+			"sha256": "`+sha(png)+`",
+			"uploaded_at": "2024-05-01T00:00:00Z"
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("link a slip uploaded before", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key": "`+key+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c, rec := newContext(req, "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		expectStored(mock, key, true)
+		mock.ExpectQuery(cStmt).WithArgs(int64(7), key, "image/png", int64(len(png)), sha(png)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "uploaded_at"}).AddRow(3, uploadedAt))
+
+		store := newStore(t)
+		store.Put(context.Background(), key, strings.NewReader(png), int64(len(png)), "image/png")
+		err := New(db, store, nil).Attach(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject a slip stored by another spender", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key": "`+key+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c, _ := newContext(req, "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		expectStored(mock, key, false)
+
+		store := newStore(t)
+		store.Put(context.Background(), key, strings.NewReader(png), int64(len(png)), "image/png")
+		err := New(db, store, nil).Attach(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject a slip already attached", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key": "`+key+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c, _ := newContext(req, "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		expectStored(mock, key, true)
+		mock.ExpectQuery(cStmt).WithArgs(int64(7), key, "image/png", int64(len(png)), sha(png)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "uploaded_at"}))
+
+		store := newStore(t)
+		store.Put(context.Background(), key, strings.NewReader(png), int64(len(png)), "image/png")
+		err := New(db, store, nil).Attach(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+	})
+
+	invalid := map[string]struct {
+		body   string
+		status int
+	}{
+		"unknown key":      {`{"key": "../../etc/passwd"}`, http.StatusBadRequest},
+		"missing key":      {`{}`, http.StatusBadRequest},
+		"never uploaded":   {`{"key": "eslips/` + sha("other") + `.png"}`, http.StatusUnprocessableEntity},
+		"malformed body":   {`{ bad }`, http.StatusBadRequest},
+		"wrong media type": {"", http.StatusUnsupportedMediaType},
+	}
+	for name, tc := range invalid {
+		t.Run("reject "+name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			c, _ := newContext(req, "7")
+
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			expectOwner(mock, 1)
+			expectStored(mock, sqlmock.AnyArg(), true)
+
+			store := newStore(t)
+			err := New(db, store, nil).Attach(c)
+
+			assert.Equal(t, tc.status, problem.Status(err))
+		})
+	}
+
+	t.Run("hide transactions of another spender", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key": "`+key+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c, _ := newContext(req, "7")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 2)
+
+		err := New(db, nil, nil).Attach(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+		assert.ErrorContains(t, err, "transaction not found")
+	})
+}
+
+func TestGetAll(t *testing.T) {
+	c, rec := newContext(httptest.NewRequest(http.MethodGet, "/", nil), "7")
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	expectOwner(mock, 1)
+	mock.ExpectQuery(tStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(3, 7, "eslips/a.png", "image/png", 13, "a", uploadedAt).
+		AddRow(4, 7, "eslips/b.pdf", "application/pdf", 20, "b", uploadedAt))
+
+	err := New(db, nil, nil).GetAll(c)
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"id": 3, "transaction_id": 7, "key": "eslips/a.png", "content_type": "image/png", "size": 13, "sha256": "a", "uploaded_at": "2024-05-01T00:00:00Z"},
+		{"id": 4, "transaction_id": 7, "key": "eslips/b.pdf", "content_type": "application/pdf", "size": 20, "sha256": "b", "uploaded_at": "2024-05-01T00:00:00Z"}
+	]`, rec.Body.String())
+}
+
+func TestDetach(t *testing.T) {
+	t.Run("detach a slip", func(t *testing.T) {
+		c, rec := newContext(httptest.NewRequest(http.MethodDelete, "/", nil), "7", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		mock.ExpectExec(dStmt).WithArgs(int64(3), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(db, nil, nil).Detach(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("detach an unknown slip", func(t *testing.T) {
+		c, _ := newContext(httptest.NewRequest(http.MethodDelete, "/", nil), "7", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		mock.ExpectExec(dStmt).WithArgs(int64(3), int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := New(db, nil, nil).Detach(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestFile(t *testing.T) {
+	key := "eslips/" + sha(png) + ".png"
+
+	t.Run("stream the stored slip", func(t *testing.T) {
+		c, rec := newContext(httptest.NewRequest(http.MethodGet, "/", nil), "7", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		mock.ExpectQuery(gStmt).WithArgs(int64(3), int64(7)).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, 7, key, "image/png", len(png), sha(png), uploadedAt))
+
+		store := newStore(t)
+		store.Put(context.Background(), key, strings.NewReader(png), int64(len(png)), "image/png")
+		err := New(db, store, nil).File(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `"`+sha(png)+`"`, rec.Header().Get("ETag"))
+		assert.Equal(t, png, rec.Body.String())
+	})
+
+	t.Run("stream an unknown slip", func(t *testing.T) {
+		c, _ := newContext(httptest.NewRequest(http.MethodGet, "/", nil), "7", "3")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectOwner(mock, 1)
+		mock.ExpectQuery(gStmt).WithArgs(int64(3), int64(7)).WillReturnRows(sqlmock.NewRows(columns))
+
+		err := New(db, nil, nil).File(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
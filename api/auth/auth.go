@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Credentials struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type handler struct {
+	keys *Keys
+	db   *sql.DB
+}
+
+func New(keys *Keys, db *sql.DB) *handler {
+	return &handler{keys, db}
+}
+
+const lStmt = `SELECT id, password_hash, role FROM spender WHERE email = $1 AND archived_at IS NULL`
+
+// errLogin is the only failure a caller sees, so it cannot tell an unknown
+// email from a wrong password.
+var errLogin = problem.Unauthorized("invalid email or password")
+
+// Token exchanges a spender's email and password for an access token.
+func (h handler) Token(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var cred Credentials
+	if err := c.Bind(&cred); err != nil {
+		return problem.BadRequest(err)
+	}
+	cred.Email = strings.ToLower(strings.TrimSpace(cred.Email))
+	if err := c.Validate(cred); err != nil {
+		return err
+	}
+
+	var id Identity
+	var hash sql.NullString
+	err := h.db.QueryRowContext(ctx, lStmt, cred.Email).Scan(&id.SpenderID, &hash, &id.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errLogin
+	}
+	if err != nil {
+		return err
+	}
+	if !hash.Valid || bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(cred.Password)) != nil {
+		return errLogin
+	}
+
+	token, _, err := h.keys.Sign(id)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("token issued", zap.Int64("spender_id", id.SpenderID), zap.String("role", string(id.Role)))
+	return c.JSON(http.StatusOK, Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.keys.ttl.Seconds()),
+	})
+}
+
+// HashPassword returns the bcrypt hash stored for a spender's password.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(b), err
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	hash, _ := HashPassword("s3cret-pass")
+
+	request := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validate.New()
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("issue token for valid credentials", func(t *testing.T) {
+		c, rec := request(`{"email": "hong@jot.ok", "password": "s3cret-pass"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(lStmt).WithArgs("hong@jot.ok").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "role"}).AddRow(7, hash, "admin"))
+
+		keys, _ := NewKeys(hsConfig())
+		err := New(keys, db).Token(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var got Token
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, "Bearer", got.TokenType)
+		assert.Equal(t, int64(3600), got.ExpiresIn)
+		id, err := keys.Verify(got.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, Identity{SpenderID: 7, Role: RoleAdmin}, id)
+	})
+
+	rejected := map[string]*sqlmock.Rows{
+		"wrong password":          sqlmock.NewRows([]string{"id", "password_hash", "role"}).AddRow(7, hash, "spender"),
+		"spender has no password": sqlmock.NewRows([]string{"id", "password_hash", "role"}).AddRow(7, nil, "spender"),
+		"unknown email":           sqlmock.NewRows([]string{"id", "password_hash", "role"}),
+	}
+	for name, rows := range rejected {
+		t.Run("reject "+name, func(t *testing.T) {
+			c, _ := request(`{"email": "hong@jot.ok", "password": "wrong-pass"}`)
+
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			mock.ExpectQuery(lStmt).WithArgs("hong@jot.ok").WillReturnRows(rows)
+
+			keys, _ := NewKeys(hsConfig())
+			err := New(keys, db).Token(c)
+
+			assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+			assert.EqualError(t, err, "invalid email or password")
+		})
+	}
+
+	t.Run("reject missing password", func(t *testing.T) {
+		c, _ := request(`{"email": "hong@jot.ok"}`)
+
+		keys, _ := NewKeys(hsConfig())
+		err := New(keys, nil).Token(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "password is required")
+	})
+}
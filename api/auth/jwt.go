@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrSigningDisabled = errors.New("token signing is not configured")
+
+type claims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role"`
+}
+
+// Keys signs and verifies access tokens with the algorithm chosen in
+// config.Auth.
+type Keys struct {
+	method jwt.SigningMethod
+	sign   any
+	verify any
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewKeys(cfg config.Auth) (*Keys, error) {
+	k := &Keys{issuer: cfg.JWTIssuer, ttl: cfg.JWTTTL, now: time.Now}
+	if k.ttl <= 0 {
+		return nil, fmt.Errorf("invalid token ttl %s", cfg.JWTTTL)
+	}
+
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("HS256 requires a secret")
+		}
+		k.method = jwt.SigningMethodHS256
+		k.sign = []byte(cfg.JWTSecret)
+		k.verify = []byte(cfg.JWTSecret)
+	case "RS256":
+		if cfg.JWTPublicKey == "" {
+			return nil, errors.New("RS256 requires a public key")
+		}
+		pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(cfg.JWTPublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		k.method = jwt.SigningMethodRS256
+		k.verify = pub
+
+		if cfg.JWTPrivateKey != "" {
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.JWTPrivateKey))
+			if err != nil {
+				return nil, fmt.Errorf("parse private key: %w", err)
+			}
+			if !priv.PublicKey.Equal(pub) {
+				return nil, errors.New("private key does not match public key")
+			}
+			k.sign = priv
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, must be HS256 or RS256", cfg.JWTAlgorithm)
+	}
+
+	return k, nil
+}
+
+// Sign issues a token for id that expires after the configured ttl.
+func (k *Keys) Sign(id Identity) (string, time.Time, error) {
+	if k.sign == nil {
+		return "", time.Time{}, ErrSigningDisabled
+	}
+
+	now := k.now()
+	exp := now.Add(k.ttl)
+	c := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(id.SpenderID, 10),
+			Issuer:    k.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		Role: id.Role,
+	}
+
+	token, err := jwt.NewWithClaims(k.method, c).SignedString(k.sign)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, exp, nil
+}
+
+// Verify checks the signature, algorithm, issuer and expiry of token and
+// returns the identity it was issued for. Tokens without a role claim belong
+// to a spender.
+func (k *Keys) Verify(token string) (Identity, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (any, error) {
+		return k.verify, nil
+	},
+		jwt.WithValidMethods([]string{k.method.Alg()}),
+		jwt.WithIssuer(k.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(k.now),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if c.Role == "" {
+		c.Role = RoleSpender
+	}
+	if !c.Role.Valid() {
+		return Identity{}, fmt.Errorf("invalid role %q", c.Role)
+	}
+	if c.Role == RoleService {
+		return Identity{Role: RoleService}, nil
+	}
+
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || id <= 0 {
+		return Identity{}, fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	return Identity{SpenderID: id, Role: c.Role}, nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func hsConfig() config.Auth {
+	return config.Auth{JWTAlgorithm: "HS256", JWTSecret: "secret", JWTIssuer: "hongjot", JWTTTL: time.Hour}
+}
+
+func rsConfig(t *testing.T) config.Auth {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	return config.Auth{
+		JWTAlgorithm:  "RS256",
+		JWTPrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		JWTPublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		JWTIssuer:     "hongjot",
+		JWTTTL:        time.Hour,
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for name, cfg := range map[string]config.Auth{"HS256": hsConfig(), "RS256": rsConfig(t)} {
+		t.Run("sign and verify with "+name, func(t *testing.T) {
+			keys, err := NewKeys(cfg)
+			assert.NoError(t, err)
+
+			token, exp, err := keys.Sign(Identity{SpenderID: 7, Role: RoleSpender})
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), exp, time.Minute)
+
+			id, err := keys.Verify(token)
+			assert.NoError(t, err)
+			assert.Equal(t, Identity{SpenderID: 7, Role: RoleSpender}, id)
+		})
+	}
+
+	t.Run("verify service token without spender", func(t *testing.T) {
+		keys, _ := NewKeys(hsConfig())
+		token, _, _ := keys.Sign(Identity{Role: RoleService})
+
+		id, err := keys.Verify(token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Identity{Role: RoleService}, id)
+	})
+
+	t.Run("treat token without role as spender", func(t *testing.T) {
+		keys, _ := NewKeys(hsConfig())
+		token, _, _ := keys.Sign(Identity{SpenderID: 7})
+
+		id, err := keys.Verify(token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, RoleSpender, id.Role)
+	})
+
+	t.Run("reject token with unknown role", func(t *testing.T) {
+		keys, _ := NewKeys(hsConfig())
+		token, _, _ := keys.Sign(Identity{SpenderID: 7, Role: "root"})
+
+		_, err := keys.Verify(token)
+
+		assert.ErrorContains(t, err, "invalid role")
+	})
+
+	t.Run("reject expired token", func(t *testing.T) {
+		keys, _ := NewKeys(hsConfig())
+		token, _, _ := keys.Sign(Identity{SpenderID: 7})
+
+		keys.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		_, err := keys.Verify(token)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	})
+
+	t.Run("reject token signed with another algorithm", func(t *testing.T) {
+		hs, _ := NewKeys(config.Auth{JWTAlgorithm: "HS256", JWTSecret: "secret", JWTIssuer: "hongjot", JWTTTL: time.Hour})
+		token, _, _ := hs.Sign(Identity{SpenderID: 7})
+
+		rs, _ := NewKeys(rsConfig(t))
+		_, err := rs.Verify(token)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("reject token from another issuer", func(t *testing.T) {
+		cfg := hsConfig()
+		cfg.JWTIssuer = "someone-else"
+		other, _ := NewKeys(cfg)
+		token, _, _ := other.Sign(Identity{SpenderID: 7})
+
+		keys, _ := NewKeys(hsConfig())
+		_, err := keys.Verify(token)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+	})
+
+	t.Run("verify only when RS256 has no private key", func(t *testing.T) {
+		cfg := rsConfig(t)
+		cfg.JWTPrivateKey = ""
+		keys, err := NewKeys(cfg)
+		assert.NoError(t, err)
+
+		_, _, err = keys.Sign(Identity{SpenderID: 7})
+
+		assert.ErrorIs(t, err, ErrSigningDisabled)
+	})
+
+	invalid := map[string]config.Auth{
+		"unknown algorithm":  {JWTAlgorithm: "none", JWTTTL: time.Hour},
+		"missing secret":     {JWTAlgorithm: "HS256", JWTTTL: time.Hour},
+		"missing public key": {JWTAlgorithm: "RS256", JWTTTL: time.Hour},
+		"malformed key":      {JWTAlgorithm: "RS256", JWTPublicKey: "not a pem", JWTTTL: time.Hour},
+		"zero ttl":           {JWTAlgorithm: "HS256", JWTSecret: "secret"},
+	}
+	for name, cfg := range invalid {
+		t.Run("reject config with "+name, func(t *testing.T) {
+			_, err := NewKeys(cfg)
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const identityKey = "identity"
+
+// Identity is the authenticated caller of a request. SpenderID is zero for a
+// service, whose API key, KeyID, grants Scopes.
+type Identity struct {
+	SpenderID int64
+	Role      Role
+	Scopes    []string
+	KeyID     int64
+}
+
+// FromContext returns the identity Middleware bound to c.
+func FromContext(c echo.Context) (Identity, bool) {
+	id, ok := c.Get(identityKey).(Identity)
+	return id, ok
+}
+
+// SetIdentity binds id to c as if Middleware had authenticated it.
+func SetIdentity(c echo.Context, id Identity) {
+	c.Set(identityKey, id)
+}
+
+// ErrInvalidKey is returned by a KeyVerifier for unknown, malformed or revoked
+// keys.
+var ErrInvalidKey = errors.New("invalid api key")
+
+// KeyVerifier resolves an API key to the service Identity it was minted for.
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context, key string) (Identity, error)
+}
+
+// Middleware rejects requests without valid credentials and binds the
+// caller's Identity into the context. Users send `Authorization: Bearer
+// <token>`, services `Authorization: ApiKey <key>` unless apiKeys is nil.
+func Middleware(keys *Keys, apiKeys KeyVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scheme, cred, _ := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+			switch {
+			case strings.EqualFold(scheme, "Bearer") && cred != "":
+				id, err := keys.Verify(cred)
+				if err != nil {
+					mlog.L(c).Info("invalid token", zap.Error(err))
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+					return problem.Unauthorized("invalid or expired token")
+				}
+				SetIdentity(c, id)
+			case strings.EqualFold(scheme, "ApiKey") && cred != "" && apiKeys != nil:
+				id, err := apiKeys.VerifyKey(c.Request().Context(), cred)
+				if errors.Is(err, ErrInvalidKey) {
+					mlog.L(c).Info("invalid api key", zap.Error(err))
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "ApiKey")
+					return problem.Unauthorized("invalid or revoked api key")
+				}
+				if err != nil {
+					return err
+				}
+				SetIdentity(c, id)
+			default:
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				if apiKeys != nil {
+					c.Response().Header().Add(echo.HeaderWWWAuthenticate, "ApiKey")
+				}
+				return problem.Unauthorized("missing credentials")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// OwnSpender only lets the spender named by the path parameter param, or an
+// identity not limited to one spender, through. It must run after Middleware.
+func OwnSpender(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := FromContext(c)
+			if !ok {
+				return problem.Unauthorized("missing identity")
+			}
+
+			spender, err := strconv.ParseInt(c.Param(param), 10, 64)
+			if err != nil {
+				return problem.BadRequest(err)
+			}
+			if scope := id.SpenderScope(); scope != nil && *scope != spender {
+				return problem.Forbidden("access to another spender's data is not allowed")
+			}
+
+			return next(c)
+		}
+	}
+}
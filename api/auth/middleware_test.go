@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	keys, _ := NewKeys(hsConfig())
+	token, _, _ := keys.Sign(Identity{SpenderID: 7, Role: RoleSpender})
+
+	call := func(authorization string) (echo.Context, error) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := Middleware(keys, nil)(func(c echo.Context) error { return nil })(c)
+		return c, err
+	}
+
+	t.Run("bind identity of a valid token", func(t *testing.T) {
+		c, err := call("Bearer " + token)
+
+		assert.NoError(t, err)
+		id, ok := FromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, int64(7), id.SpenderID)
+	})
+
+	t.Run("reject request without token", func(t *testing.T) {
+		c, err := call("")
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+		assert.Equal(t, "Bearer", c.Response().Header().Get(echo.HeaderWWWAuthenticate))
+	})
+
+	t.Run("reject tampered token", func(t *testing.T) {
+		_, err := call("Bearer " + token + "x")
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+	})
+
+	t.Run("reject other schemes", func(t *testing.T) {
+		_, err := call("Basic " + token)
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+	})
+}
+
+type stubVerifier struct {
+	id  Identity
+	err error
+}
+
+func (s stubVerifier) VerifyKey(context.Context, string) (Identity, error) {
+	return s.id, s.err
+}
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	keys, _ := NewKeys(hsConfig())
+
+	call := func(v KeyVerifier, authorization string) (echo.Context, error) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := Middleware(keys, v)(func(c echo.Context) error { return nil })(c)
+		return c, err
+	}
+
+	t.Run("bind service identity of a valid key", func(t *testing.T) {
+		service := Identity{Role: RoleService, Scopes: []string{ScopeTransactionsCreate}}
+		c, err := call(stubVerifier{id: service}, "ApiKey hj_abcdefgh_secret")
+
+		assert.NoError(t, err)
+		id, _ := FromContext(c)
+		assert.Equal(t, service, id)
+	})
+
+	t.Run("reject invalid key", func(t *testing.T) {
+		c, err := call(stubVerifier{err: ErrInvalidKey}, "ApiKey hj_abcdefgh_secret")
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+		assert.Equal(t, "ApiKey", c.Response().Header().Get(echo.HeaderWWWAuthenticate))
+	})
+
+	t.Run("fail when keys cannot be looked up", func(t *testing.T) {
+		_, err := call(stubVerifier{err: assert.AnError}, "ApiKey hj_abcdefgh_secret")
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+
+	t.Run("reject api key when keys are disabled", func(t *testing.T) {
+		_, err := call(nil, "ApiKey hj_abcdefgh_secret")
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+	})
+
+	t.Run("challenge both schemes without credentials", func(t *testing.T) {
+		c, err := call(stubVerifier{}, "")
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+		assert.Equal(t, []string{"Bearer", "ApiKey"}, c.Response().Header().Values(echo.HeaderWWWAuthenticate))
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	call := func(id Identity) error {
+		e := echo.New()
+		defer e.Close()
+
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		SetIdentity(c, id)
+
+		return RequireScope(ScopeTransactionsCreate)(func(c echo.Context) error { return nil })(c)
+	}
+
+	t.Run("allow users without scopes", func(t *testing.T) {
+		assert.NoError(t, call(Identity{SpenderID: 7, Role: RoleSpender}))
+	})
+
+	t.Run("allow service with the scope", func(t *testing.T) {
+		assert.NoError(t, call(Identity{Role: RoleService, Scopes: []string{ScopeTransactionsCreate}}))
+	})
+
+	t.Run("forbid service without the scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, problem.Status(call(Identity{Role: RoleService})))
+	})
+}
+
+func TestOwnSpender(t *testing.T) {
+	call := func(param string, id *Identity) error {
+		e := echo.New()
+		defer e.Close()
+
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues(param)
+		if id != nil {
+			SetIdentity(c, *id)
+		}
+
+		return OwnSpender("id")(func(c echo.Context) error { return nil })(c)
+	}
+
+	t.Run("allow the caller's own data", func(t *testing.T) {
+		assert.NoError(t, call("7", &Identity{SpenderID: 7, Role: RoleSpender}))
+	})
+
+	t.Run("allow admin to reach any spender", func(t *testing.T) {
+		assert.NoError(t, call("8", &Identity{SpenderID: 7, Role: RoleAdmin}))
+	})
+
+	t.Run("forbid another spender's data", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, problem.Status(call("8", &Identity{SpenderID: 7, Role: RoleSpender})))
+	})
+
+	t.Run("reject malformed id", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, problem.Status(call("abc", &Identity{SpenderID: 7, Role: RoleSpender})))
+	})
+
+	t.Run("reject unauthenticated request", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(call("7", nil)))
+	})
+}
+
+func TestRequire(t *testing.T) {
+	call := func(id *Identity) error {
+		e := echo.New()
+		defer e.Close()
+
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		if id != nil {
+			SetIdentity(c, *id)
+		}
+
+		return Require(RoleAdmin, RoleService)(func(c echo.Context) error { return nil })(c)
+	}
+
+	t.Run("allow listed roles", func(t *testing.T) {
+		assert.NoError(t, call(&Identity{Role: RoleAdmin}))
+		assert.NoError(t, call(&Identity{Role: RoleService}))
+	})
+
+	t.Run("forbid other roles", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, problem.Status(call(&Identity{SpenderID: 7, Role: RoleSpender})))
+	})
+
+	t.Run("reject unauthenticated request", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(call(nil)))
+	})
+}
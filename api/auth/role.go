@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+)
+
+// Role decides which operations an identity may perform.
+type Role string
+
+const (
+	// RoleAdmin manages every spender's data.
+	RoleAdmin Role = "admin"
+	// RoleSpender only reaches its own data.
+	RoleSpender Role = "spender"
+	// RoleService is a machine client acting on behalf of any spender.
+	RoleService Role = "service"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleSpender, RoleService:
+		return true
+	}
+	return false
+}
+
+// SpenderScope returns the only spender whose data id may reach, nil when id
+// is not limited to a single spender.
+func (id Identity) SpenderScope() *int64 {
+	if id.Role != RoleSpender {
+		return nil
+	}
+	spender := id.SpenderID
+	return &spender
+}
+
+// Require is the policy letting only identities with one of roles through,
+// it must run after Middleware.
+func Require(roles ...Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := FromContext(c)
+			if !ok {
+				return problem.Unauthorized("missing identity")
+			}
+			for _, r := range roles {
+				if id.Role == r {
+					return next(c)
+				}
+			}
+			return problem.Forbidden("role " + string(id.Role) + " may not perform this operation")
+		}
+	}
+}
+
+// Scopes an API key may grant a service.
+const (
+	ScopeTransactionsCreate = "transactions:create"
+	ScopeSpendersRead       = "spenders:read"
+)
+
+// ValidScope reports whether scope is one an API key may grant.
+func ValidScope(scope string) bool {
+	return scope == ScopeTransactionsCreate || scope == ScopeSpendersRead
+}
+
+// RequireScope lets users through and services only when their API key
+// grants scope, it must run after Middleware.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := FromContext(c)
+			if !ok {
+				return problem.Unauthorized("missing identity")
+			}
+			if id.Role == RoleService && !slices.Contains(id.Scopes, scope) {
+				return problem.Forbidden("api key lacks scope " + scope)
+			}
+			return next(c)
+		}
+	}
+}
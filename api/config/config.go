@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 )
@@ -14,6 +15,12 @@ type Config struct {
 	Database    Database
 	Server      Server
 	FeatureFlag FeatureFlag
+	Auth        Auth
+	Storage     Storage
+	Upload      Upload
+	Extract     Extract
+	Queue       Queue
+	Idempotency Idempotency
 }
 
 func (c Config) PostgresURI() string {
@@ -28,8 +35,104 @@ type Database struct {
 	PostgresURI string `env:"DATABASE_POSTGRES_URI,required"`
 }
 
+// FeatureFlag toggles behaviour. SpenderDeletePolicy decides what deleting
+// a spender does to their transactions: "reject" refuses while any exist,
+// "cascade" deletes them along and "archive" only hides the spender.
 type FeatureFlag struct {
-	EnableCreateSpender bool `env:"ENABLE_CREATE_SPENDER"`
+	EnableCreateSpender bool   `env:"ENABLE_CREATE_SPENDER"`
+	SpenderDeletePolicy string `env:"SPENDER_DELETE_POLICY" envDefault:"reject"`
+}
+
+// Auth configures how access tokens are signed and verified. HS256 uses
+// JWTSecret, RS256 uses the PEM encoded JWTPrivateKey and JWTPublicKey; a
+// verifying-only deployment may leave the private key empty.
+type Auth struct {
+	JWTAlgorithm  string        `env:"AUTH_JWT_ALGORITHM" envDefault:"HS256"`
+	JWTSecret     string        `env:"AUTH_JWT_SECRET"`
+	JWTPrivateKey string        `env:"AUTH_JWT_PRIVATE_KEY"`
+	JWTPublicKey  string        `env:"AUTH_JWT_PUBLIC_KEY"`
+	JWTIssuer     string        `env:"AUTH_JWT_ISSUER" envDefault:"hongjot"`
+	JWTTTL        time.Duration `env:"AUTH_JWT_TTL" envDefault:"1h"`
+}
+
+// Storage selects where uploaded e-slips are kept: "local" writes below
+// LocalDir, "s3" uses a bucket of any S3-compatible service.
+type Storage struct {
+	Backend     string `env:"STORAGE_BACKEND" envDefault:"local"`
+	LocalDir    string `env:"STORAGE_LOCAL_DIR" envDefault:"./data/uploads"`
+	S3Endpoint  string `env:"STORAGE_S3_ENDPOINT"`
+	S3Region    string `env:"STORAGE_S3_REGION" envDefault:"us-east-1"`
+	S3Bucket    string `env:"STORAGE_S3_BUCKET"`
+	S3AccessKey string `env:"STORAGE_S3_ACCESS_KEY"`
+	S3SecretKey string `env:"STORAGE_S3_SECRET_KEY"`
+}
+
+// Upload limits the e-slip upload endpoint, sizes are in bytes.
+type Upload struct {
+	MaxFileSize    int64 `env:"UPLOAD_MAX_FILE_SIZE" envDefault:"10485760"`
+	MaxRequestSize int64 `env:"UPLOAD_MAX_REQUEST_SIZE" envDefault:"26214400"`
+}
+
+// Extract configures reading draft transactions from uploaded slips. OCR
+// names the text provider and QR the QR code reader, each is disabled when
+// empty.
+type Extract struct {
+	OCR            string `env:"EXTRACT_OCR"`
+	TesseractPath  string `env:"EXTRACT_TESSERACT_PATH" envDefault:"tesseract"`
+	TesseractLangs string `env:"EXTRACT_TESSERACT_LANGS" envDefault:"tha+eng"`
+	QR             string `env:"EXTRACT_QR"`
+	ZBarPath       string `env:"EXTRACT_ZBAR_PATH" envDefault:"zbarimg"`
+}
+
+// Queue configures the background job workers. A failed job is retried
+// after Backoff, doubled on every attempt up to MaxBackoff, and dead-lettered
+// after MaxAttempts. A running job is handed to another worker once its
+// Lease expires.
+type Queue struct {
+	Workers      int           `env:"QUEUE_WORKERS" envDefault:"2"`
+	PollInterval time.Duration `env:"QUEUE_POLL_INTERVAL" envDefault:"1s"`
+	MaxAttempts  int           `env:"QUEUE_MAX_ATTEMPTS" envDefault:"5"`
+	Backoff      time.Duration `env:"QUEUE_BACKOFF" envDefault:"5s"`
+	MaxBackoff   time.Duration `env:"QUEUE_MAX_BACKOFF" envDefault:"10m"`
+	Lease        time.Duration `env:"QUEUE_LEASE" envDefault:"5m"`
+}
+
+// Idempotency configures how long the responses of requests sent with an
+// Idempotency-Key header are kept to be replayed for retries, expired ones
+// are purged every PurgeInterval.
+type Idempotency struct {
+	TTL           time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	PurgeInterval time.Duration `env:"IDEMPOTENCY_PURGE_INTERVAL" envDefault:"1h"`
+}
+
+func (q Queue) validate() error {
+	if q.Workers <= 0 {
+		return fmt.Errorf("QUEUE_WORKERS must be positive, got %d", q.Workers)
+	}
+	if q.MaxAttempts <= 0 {
+		return fmt.Errorf("QUEUE_MAX_ATTEMPTS must be positive, got %d", q.MaxAttempts)
+	}
+	for name, d := range map[string]time.Duration{
+		"QUEUE_POLL_INTERVAL": q.PollInterval,
+		"QUEUE_BACKOFF":       q.Backoff,
+		"QUEUE_MAX_BACKOFF":   q.MaxBackoff,
+		"QUEUE_LEASE":         q.Lease,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", name, d)
+		}
+	}
+	return nil
+}
+
+func (i Idempotency) validate() error {
+	if i.TTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL must be positive, got %s", i.TTL)
+	}
+	if i.PurgeInterval <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_PURGE_INTERVAL must be positive, got %s", i.PurgeInterval)
+	}
+	return nil
 }
 
 func Env(key string) string {
@@ -71,6 +174,42 @@ func parse(envPrefix string) (Config, error) {
 		return Config{}, errors.New("failed to parse feature flag config:" + err.Error())
 	}
 
+	auth := &Auth{}
+	if err := env.ParseWithOptions(auth, opts); err != nil {
+		return Config{}, errors.New("failed to parse auth config:" + err.Error())
+	}
+
+	storage := &Storage{}
+	if err := env.ParseWithOptions(storage, opts); err != nil {
+		return Config{}, errors.New("failed to parse storage config:" + err.Error())
+	}
+
+	upload := &Upload{}
+	if err := env.ParseWithOptions(upload, opts); err != nil {
+		return Config{}, errors.New("failed to parse upload config:" + err.Error())
+	}
+
+	extract := &Extract{}
+	if err := env.ParseWithOptions(extract, opts); err != nil {
+		return Config{}, errors.New("failed to parse extract config:" + err.Error())
+	}
+
+	queue := &Queue{}
+	if err := env.ParseWithOptions(queue, opts); err != nil {
+		return Config{}, errors.New("failed to parse queue config:" + err.Error())
+	}
+	if err := queue.validate(); err != nil {
+		return Config{}, errors.New("invalid queue config: " + err.Error())
+	}
+
+	idempotency := &Idempotency{}
+	if err := env.ParseWithOptions(idempotency, opts); err != nil {
+		return Config{}, errors.New("failed to parse idempotency config:" + err.Error())
+	}
+	if err := idempotency.validate(); err != nil {
+		return Config{}, errors.New("invalid idempotency config: " + err.Error())
+	}
+
 	port := Env("SERVER_PORT")
 	if port == "" {
 		port = "8080"
@@ -85,7 +224,14 @@ func parse(envPrefix string) (Config, error) {
 		},
 		FeatureFlag: FeatureFlag{
 			EnableCreateSpender: feats.EnableCreateSpender,
+			SpenderDeletePolicy: feats.SpenderDeletePolicy,
 		},
+		Auth:        *auth,
+		Storage:     *storage,
+		Upload:      *upload,
+		Extract:     *extract,
+		Queue:       *queue,
+		Idempotency: *idempotency,
 	}, nil
 }
 
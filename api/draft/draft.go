@@ -0,0 +1,277 @@
+package draft
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/extract"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/qr"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transactions"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+)
+
+// Draft is a transaction read from an uploaded slip, waiting for its spender
+// to confirm it.
+type Draft struct {
+	ID            int64     `json:"id"`
+	SpenderID     *int64    `json:"spender_id"`
+	Key           string    `json:"key"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	Bank          string    `json:"bank"`
+	Reference     string    `json:"reference"`
+	Status        string    `json:"status"`
+	TransactionID *int64    `json:"transaction_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	extract.Draft
+}
+
+// Confirmation completes a draft. Amount, Date and Note override what was
+// extracted, Note defaults to the merchant.
+type Confirmation struct {
+	Amount          *money.Amount `json:"amount"`
+	Date            *time.Time    `json:"date"`
+	Currency        string        `json:"currency"`
+	Category        string        `json:"category"`
+	TransactionType string        `json:"transaction_type"`
+	Note            *string       `json:"note"`
+	SpenderID       int64         `json:"spender_id"`
+}
+
+type handler struct {
+	db *sql.DB
+	ex extract.Extractor
+	qr qr.Reader
+}
+
+// New returns the draft handler, ex and qr may be nil when text extraction
+// or QR decoding is disabled.
+func New(db *sql.DB, ex extract.Extractor, qr qr.Reader) *handler {
+	return &handler{db, ex, qr}
+}
+
+const (
+	cStmt = `INSERT INTO draft (spender_id, storage_key, content_type, size, sha256, amount, date, merchant, amount_confidence, date_confidence, merchant_confidence, bank, reference) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id;`
+	gStmt = `SELECT id, spender_id, storage_key, content_type, size, sha256, amount, date, merchant, amount_confidence, date_confidence, merchant_confidence, bank, reference, status, transaction_id, created_at FROM draft WHERE id = $1`
+	lStmt = gStmt + ` FOR UPDATE`
+	uStmt = `UPDATE draft SET status = 'confirmed', transaction_id = $2 WHERE id = $1;`
+
+	// tStmt and aStmt record the confirmed transaction with its slip.
+	tStmt = `INSERT INTO transaction (date, amount, currency, category, transaction_type, note, image_url, spender_id, reference) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	aStmt = `INSERT INTO attachment (transaction_id, storage_key, content_type, size, sha256) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (transaction_id, sha256) DO NOTHING;`
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDraft(row scanner, d *Draft) error {
+	return row.Scan(&d.ID, &d.SpenderID, &d.Key, &d.ContentType, &d.Size, &d.SHA256,
+		&d.Amount, &d.Date, &d.Merchant, &d.Confidence.Amount, &d.Confidence.Date, &d.Confidence.Merchant,
+		&d.Bank, &d.Reference, &d.Status, &d.TransactionID, &d.CreatedAt)
+}
+
+// Draft implements upload.Drafter. The slip is read for text and for a
+// slip verification QR code, it is skipped without a draft when neither
+// could be read.
+func (h handler) Draft(ctx context.Context, spender *int64, slip eslip.Result, r io.Reader) (int64, error) {
+	if h.ex == nil && h.qr == nil {
+		return 0, nil
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	read := false
+	var x extract.Draft
+	if h.ex != nil {
+		x, err = h.ex.Extract(ctx, slip.ContentType, bytes.NewReader(b))
+		switch {
+		case err == nil:
+			read = true
+		case !errors.Is(err, extract.ErrUnsupported):
+			return 0, err
+		}
+	}
+	var s qr.Slip
+	if h.qr != nil {
+		s, err = qr.ReadSlip(ctx, h.qr, slip.ContentType, bytes.NewReader(b))
+		switch {
+		case err == nil:
+			read = true
+		case !errors.Is(err, qr.ErrNotSlip):
+			return 0, err
+		}
+	}
+	if !read {
+		return 0, nil
+	}
+
+	var id int64
+	err = h.db.QueryRowContext(ctx, cStmt, spender, slip.Key, slip.ContentType, slip.Size, slip.SHA256,
+		x.Amount, x.Date, x.Merchant, x.Confidence.Amount, x.Confidence.Date, x.Confidence.Merchant, s.Bank, s.Reference).Scan(&id)
+	return id, err
+}
+
+var errNotFound = problem.NotFound("draft not found")
+
+// owns hides drafts of other spenders, as for transactions.
+func owns(c echo.Context, d Draft) (bool, error) {
+	id, ok := auth.FromContext(c)
+	if !ok {
+		return false, problem.Unauthorized("missing identity")
+	}
+	own := id.SpenderScope()
+	return own == nil || d.SpenderID != nil && *d.SpenderID == *own, nil
+}
+
+func (h handler) GetByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	var d Draft
+	err = scanDraft(h.db.QueryRowContext(c.Request().Context(), gStmt, id), &d)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if ok, err := owns(c, d); err != nil {
+		return err
+	} else if !ok {
+		return errNotFound
+	}
+
+	return c.JSON(http.StatusOK, d)
+}
+
+// Confirm records the draft as a transaction with its slip attached.
+func (h handler) Confirm(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	var in Confirmation
+	if err := c.Bind(&in); err != nil {
+		return problem.BadRequest(err)
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var d Draft
+	err = scanDraft(tx.QueryRowContext(ctx, lStmt, id), &d)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if ok, err := owns(c, d); err != nil {
+		return err
+	} else if !ok {
+		return errNotFound
+	}
+	if d.Status != StatusPending {
+		return problem.Conflict(fmt.Sprintf("draft is already %s", d.Status))
+	}
+
+	t := transaction(d, in)
+	if err := c.Validate(t); err != nil {
+		return err
+	}
+	// the same slip may have been uploaded, and drafted, twice
+	dup, err := transactions.FindDuplicate(ctx, tx, t)
+	if err == nil {
+		return transactions.Duplicate(dup)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, tStmt, t.Date, t.Amount, t.Currency, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID, t.Reference).Scan(&t.ID)
+	if err != nil {
+		return transactions.SpenderError(err, t.SpenderID)
+	}
+	if _, err := tx.ExecContext(ctx, aStmt, t.ID, d.Key, d.ContentType, d.Size, d.SHA256); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, uStmt, d.ID, t.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logger.Info("draft confirmed", zap.Int64("id", d.ID), zap.Int64("transaction_id", t.ID))
+	return c.JSON(http.StatusCreated, t)
+}
+
+// transaction merges the confirmation over what was extracted. Drafts of a
+// spender always stay with that spender.
+func transaction(d Draft, in Confirmation) transactions.Transaction {
+	t := transactions.Transaction{
+		Currency:        strings.ToUpper(strings.TrimSpace(in.Currency)),
+		Category:        in.Category,
+		TransactionType: in.TransactionType,
+		Note:            d.Merchant,
+		SpenderID:       in.SpenderID,
+		Reference:       d.Reference,
+	}
+	if t.Currency == "" {
+		t.Currency = money.DefaultCurrency
+	}
+	if t.TransactionType == "" {
+		t.TransactionType = "expense"
+	}
+	if d.SpenderID != nil {
+		t.SpenderID = *d.SpenderID
+	}
+
+	switch {
+	case in.Amount != nil:
+		t.Amount = *in.Amount
+	case d.Amount != nil:
+		t.Amount = *d.Amount
+	}
+	switch {
+	case in.Date != nil:
+		t.Date = *in.Date
+	case d.Date != nil:
+		t.Date = *d.Date
+	}
+	if in.Note != nil {
+		t.Note = *in.Note
+	}
+	return t
+}
@@ -0,0 +1,321 @@
+package draft
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/extract"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transactions"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExtractor returns a fixed draft, or its error, for any slip.
+type fakeExtractor struct {
+	draft extract.Draft
+	err   error
+}
+
+func (f fakeExtractor) Extract(_ context.Context, _ string, r io.Reader) (extract.Draft, error) {
+	io.Copy(io.Discard, r)
+	return f.draft, f.err
+}
+
+// fakeQR finds fixed payloads in any slip.
+type fakeQR []string
+
+func (f fakeQR) Read(_ context.Context, _ string, r io.Reader) ([]string, error) {
+	io.Copy(io.Discard, r)
+	return f, nil
+}
+
+// payload is a slip verification payload of bank 014, reference
+// 2024051212345.
+const payload = "003400060000010103014021320240512123455102TH91043C1E"
+
+var (
+	spender = auth.Identity{SpenderID: 1, Role: auth.RoleSpender}
+	admin   = auth.Identity{Role: auth.RoleAdmin}
+	slipAt  = time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+	amount  = money.Amount(125050)
+	slip    = eslip.Result{Key: "eslips/abc.png", ContentType: "image/png", Size: 13, SHA256: "abc"}
+	columns = []string{"id", "spender_id", "storage_key", "content_type", "size", "sha256", "amount", "date", "merchant",
+		"amount_confidence", "date_confidence", "merchant_confidence", "bank", "reference", "status", "transaction_id", "created_at"}
+)
+
+// dupStmt is the duplicate lookup of transactions.FindDuplicate.
+const dupStmt = `SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction WHERE spender_id = $1 AND amount = $2 AND transaction_type = $5 AND currency = $6
+	AND (reference = $4 AND $4 <> '' OR (reference = '' OR $4 = '') AND $3::timestamptz AT TIME ZONE 'UTC' <> date_trunc('day', $3::timestamptz AT TIME ZONE 'UTC')
+	AND date_trunc('minute', date) = date_trunc('minute', $3::timestamptz))
+	ORDER BY id LIMIT 1`
+
+var txColumns = []string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}
+
+func draftRow(spender any, status string) *sqlmock.Rows {
+	return sqlmock.NewRows(columns).AddRow(5, spender, slip.Key, slip.ContentType, slip.Size, slip.SHA256,
+		"1250.50", slipAt, "Doi Chaang", 0.9, 0.6, 0.3, "014", "2024051212345", status, nil, slipAt)
+}
+
+func newContext(identity auth.Identity, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validate.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	auth.SetIdentity(c, identity)
+	return c, rec
+}
+
+func TestDraft(t *testing.T) {
+	t.Run("store what was extracted", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		x := extract.Draft{Amount: &amount, Date: &slipAt, Merchant: "Doi Chaang", Confidence: extract.Confidence{Amount: 0.9, Date: 0.6, Merchant: 0.3}}
+		mock.ExpectQuery(cStmt).
+			WithArgs(int64(1), slip.Key, slip.ContentType, slip.Size, slip.SHA256, "1250.50", slipAt, "Doi Chaang", 0.9, 0.6, 0.3, "", "").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		own := int64(1)
+
+		id, err := New(db, fakeExtractor{draft: x}, nil).Draft(context.Background(), &own, slip, strings.NewReader("png"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("store empty fields as null", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(cStmt).
+			WithArgs(nil, slip.Key, slip.ContentType, slip.Size, slip.SHA256, nil, nil, "", 0.0, 0.0, 0.0, "", "").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		_, err := New(db, fakeExtractor{}, nil).Draft(context.Background(), nil, slip, strings.NewReader("png"))
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("store bank and reference of the slip qr code", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(cStmt).
+			WithArgs(nil, slip.Key, slip.ContentType, slip.Size, slip.SHA256, nil, nil, "", 0.0, 0.0, 0.0, "014", "2024051212345").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		id, err := New(db, fakeExtractor{err: extract.ErrUnsupported}, fakeQR{payload}).Draft(context.Background(), nil, slip, strings.NewReader("png"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("skip slips that could not be read", func(t *testing.T) {
+		id, err := New(nil, fakeExtractor{err: extract.ErrUnsupported}, fakeQR{"not a slip"}).Draft(context.Background(), nil, slip, strings.NewReader("pdf"))
+
+		assert.NoError(t, err)
+		assert.Zero(t, id)
+	})
+
+	t.Run("skip when extraction is disabled", func(t *testing.T) {
+		id, err := New(nil, nil, nil).Draft(context.Background(), nil, slip, strings.NewReader("png"))
+
+		assert.NoError(t, err)
+		assert.Zero(t, id)
+	})
+}
+
+func TestGetByID(t *testing.T) {
+	t.Run("return own draft", func(t *testing.T) {
+		c, rec := newContext(spender, "")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(gStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusPending))
+
+		err := New(db, nil, nil).GetByID(c)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"id": 5,
+			"spender_id": 1,
+			"key": "eslips/abc.png",
+			"content_type": "image/png",
+			"size": 13,
+			"sha256": "abc",
+			"bank": "014",
+			"reference": "2024051212345",
+			"status": "pending",
+			"transaction_id": null,
+			"created_at": "2024-05-12T00:00:00Z",
+			"amount": 1250.50,
+			"date": "2024-05-12T00:00:00Z",
+			"merchant": "Doi Chaang",
+			"confidence": {"amount": 0.9, "date": 0.6, "merchant": 0.3}
+		}`, rec.Body.String())
+	})
+
+	t.Run("hide draft of another spender", func(t *testing.T) {
+		c, _ := newContext(spender, "")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(gStmt).WithArgs(int64(5)).WillReturnRows(draftRow(2, StatusPending))
+
+		err := New(db, nil, nil).GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestConfirm(t *testing.T) {
+	t.Run("confirm failed when the spender was deleted", func(t *testing.T) {
+		c, _ := newContext(spender, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusPending))
+		mock.ExpectQuery(dupStmt).WillReturnRows(sqlmock.NewRows(txColumns))
+		mock.ExpectQuery(tStmt).WillReturnError(&pq.Error{Code: "23503"})
+		mock.ExpectRollback()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("record transaction with the extracted values", func(t *testing.T) {
+		c, rec := newContext(spender, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusPending))
+		mock.ExpectQuery(dupStmt).WithArgs(int64(1), "1250.50", slipAt, "2024051212345", "expense", "THB").WillReturnRows(sqlmock.NewRows(txColumns))
+		mock.ExpectQuery(tStmt).WithArgs(slipAt, "1250.50", "THB", "Food", "expense", "Doi Chaang", "", int64(1), "2024051212345").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+		mock.ExpectExec(aStmt).WithArgs(int64(9), slip.Key, slip.ContentType, slip.Size, slip.SHA256).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(uStmt).WithArgs(int64(5), int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 9,
+			"date": "2024-05-12T00:00:00Z",
+			"amount": 1250.50,
+			"currency": "THB",
+			"category": "Food",
+			"transaction_type": "expense",
+			"note": "Doi Chaang",
+			"image_url": "",
+			"spender_id": 1,
+			"reference": "2024051212345"
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("apply corrections", func(t *testing.T) {
+		c, rec := newContext(spender, `{"category": "Food", "amount": 99, "date": "2024-05-13T00:00:00Z", "note": "coffee", "spender_id": 2}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusPending))
+		mock.ExpectQuery(dupStmt).WithArgs(int64(1), "99.00", slipAt.AddDate(0, 0, 1), "2024051212345", "expense", "THB").WillReturnRows(sqlmock.NewRows(txColumns))
+		mock.ExpectQuery(tStmt).WithArgs(slipAt.AddDate(0, 0, 1), "99.00", "THB", "Food", "expense", "coffee", "", int64(1), "2024051212345").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+		mock.ExpectExec(aStmt).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(uStmt).WithArgs(int64(5), int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("require a spender for drafts uploaded by admins", func(t *testing.T) {
+		c, _ := newContext(admin, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(nil, StatusPending))
+		mock.ExpectRollback()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "spender_id")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject a slip already recorded", func(t *testing.T) {
+		c, _ := newContext(spender, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusPending))
+		mock.ExpectQuery(dupStmt).WithArgs(int64(1), "1250.50", slipAt, "2024051212345", "expense", "THB").
+			WillReturnRows(sqlmock.NewRows(txColumns).AddRow(3, slipAt, "1250.50", "THB", "Food", "expense", "", "", 1, "2024051212345"))
+		mock.ExpectRollback()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+		var perr *problem.Error
+		assert.ErrorAs(t, err, &perr)
+		assert.Equal(t, int64(3), perr.Existing.(transactions.Transaction).ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject a confirmed draft", func(t *testing.T) {
+		c, _ := newContext(spender, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(1, StatusConfirmed))
+		mock.ExpectRollback()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+	})
+
+	t.Run("hide draft of another spender", func(t *testing.T) {
+		c, _ := newContext(spender, `{"category": "Food"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lStmt).WithArgs(int64(5)).WillReturnRows(draftRow(2, StatusPending))
+		mock.ExpectRollback()
+
+		err := New(db, nil, nil).Confirm(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
@@ -1,72 +1,241 @@
 package eslip
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"regexp"
 	"strings"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
-func Upload(c echo.Context) error {
+// Outcome of a single file of an upload.
+const (
+	StatusUploaded  = "uploaded"
+	StatusDuplicate = "duplicate"
+	StatusRejected  = "rejected"
+	StatusFailed    = "failed"
+)
+
+// ErrDuplicate is returned by a Processor, with the id of the earlier
+// upload, for a slip the spender already uploaded.
+var ErrDuplicate = errors.New("slip was already uploaded")
+
+// Result reports what happened to one uploaded file.
+type Result struct {
+	Filename    string `json:"filename"`
+	Status      string `json:"status"`
+	Key         string `json:"key,omitempty"`
+	Location    string `json:"location,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	UploadID    int64  `json:"upload_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Processor queues the processing of a stored slip and returns the id to
+// poll its progress with, see upload. spender is nil for uploads by admins.
+// Slips uploaded before return their earlier id with ErrDuplicate.
+type Processor interface {
+	Process(ctx context.Context, spender *int64, slip Result) (int64, error)
+}
+
+type handler struct {
+	cfg       config.Upload
+	store     storage.BlobStore
+	processor Processor
+}
+
+// New returns the upload handler, processor may be nil to only store files.
+func New(cfg config.Upload, store storage.BlobStore, processor Processor) *handler {
+	return &handler{cfg, store, processor}
+}
+
+// Upload stores every file of the multipart "images" field under a key
+// derived from its content, so the same slip uploaded twice is stored once
+// and client file names never reach the store. Stored files are then queued
+// for processing. Each file is reported on its own: the response is 202 when
+// all of them were queued, 200 when there is no processing, 409 when all of
+// them were uploaded before and 207 otherwise.
+func (h handler) Upload(c echo.Context) error {
+	logger := mlog.L(c)
+	req := c.Request()
+
+	if req.ContentLength > h.cfg.MaxRequestSize {
+		return problem.TooLarge(fmt.Sprintf("request exceeds the %d byte limit", h.cfg.MaxRequestSize))
+	}
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.cfg.MaxRequestSize)
+
 	form, err := c.MultipartForm()
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return problem.TooLarge(fmt.Sprintf("request exceeds the %d byte limit", h.cfg.MaxRequestSize))
+	}
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"message": "Failed to parse form",
-			"error":   err.Error(),
-		})
+		return problem.BadRequest(fmt.Errorf("failed to parse form: %w", err))
 	}
+	defer form.RemoveAll()
+
 	images := form.File["images"]
+	if len(images) == 0 {
+		return problem.BadRequest(errors.New("no files in the images field"))
+	}
+
+	status := http.StatusOK
+	if h.processor != nil {
+		status = http.StatusAccepted
+	}
+	results := make([]Result, 0, len(images))
 	var locations []string
+	duplicates := 0
 	for _, image := range images {
-		fmt.Printf("Uploading file: %+v\n", image.Filename)
-		src, err := image.Open()
+		res, err := h.Save(req.Context(), image)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"message": "Failed to parse form",
-				"error":   err.Error(),
-			})
+			logger.Error("image upload failed", zap.String("filename", image.Filename), zap.Error(err))
 		}
-		defer src.Close()
-
-		// upload to AWS S3 bucket
-		loc, err := UploadToS3(c, image.Filename, src)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"message": "Failed to upload image",
-				"error":   err.Error(),
-			})
+		if res.Status == StatusUploaded {
+			if err := h.process(c, &res); err != nil {
+				logger.Error("image processing not queued", zap.String("key", res.Key), zap.Error(err))
+			}
 		}
-		locations = append(locations, loc)
+		switch res.Status {
+		case StatusUploaded:
+			logger.Info("image uploaded", zap.String("filename", image.Filename), zap.String("key", res.Key), zap.Int64("upload_id", res.UploadID))
+			locations = append(locations, res.Location)
+		case StatusDuplicate:
+			logger.Info("image uploaded before", zap.String("filename", image.Filename), zap.String("key", res.Key), zap.Int64("upload_id", res.UploadID))
+			duplicates++
+			status = http.StatusMultiStatus
+		default:
+			status = http.StatusMultiStatus
+		}
+		results = append(results, res)
+	}
+	if duplicates == len(images) {
+		status = http.StatusConflict
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message":   "Image uploaded successfully",
+	message := "Image uploaded successfully"
+	if len(locations) < len(images) {
+		message = fmt.Sprintf("%d of %d images uploaded", len(locations), len(images))
+	}
+	return c.JSON(status, map[string]any{
+		"message":   message,
 		"locations": strings.Join(locations, ","),
+		"results":   results,
 	})
 }
 
-func UploadToS3(c echo.Context, filename string, src multipart.File) (string, error) {
-	// Assume that the file is uploaded to S3 bucket successfully
-	return "location/on/s3/bucket/" + filename, nil
-	// Create an AWS session
-	// sess, err := session.NewSession(&aws.Config{
-	// 	Region: aws.String(os.Getenv("AWS_REGION")),
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// Upload the file to S3
-	// result, err = s3.New(sess).PutObject(&s3.PutObjectInput{
-	// 	Bucket: aws.String(os.Getenv("AWS_BUCKET")),
-	// 	Key:    aws.String(filename),
-	// 	Body:   src,
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// return result.Location, nil
+// Save validates and stores one file. Rejections are reported in the result,
+// the returned error is only set when the store itself failed.
+func (h handler) Save(ctx context.Context, image *multipart.FileHeader) (Result, error) {
+	res := Result{Filename: image.Filename, Size: image.Size}
+	if image.Size > h.cfg.MaxFileSize {
+		return rejected(res, fmt.Sprintf("file exceeds the %d byte limit", h.cfg.MaxFileSize)), nil
+	}
+
+	f, err := image.Open()
+	if err != nil {
+		return rejected(res, "file could not be read"), nil
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return rejected(res, "file is empty"), nil
+	}
+	contentType, ext, ok := sniff(head[:n])
+	if !ok {
+		return rejected(res, "unsupported file type, expected PNG, JPEG, HEIC or PDF"), nil
+	}
+
+	sum := sha256.New()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return failed(res), err
+	}
+	if _, err := io.Copy(sum, f); err != nil {
+		return failed(res), err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return failed(res), err
+	}
+
+	res.ContentType = contentType
+	res.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	res.Key = keyPrefix + res.SHA256 + ext
+
+	res.Location, err = h.store.Put(ctx, res.Key, f, image.Size, contentType)
+	if err != nil {
+		res.Location = ""
+		return failed(res), err
+	}
+	res.Status = StatusUploaded
+	return res, nil
+}
+
+// process queues a stored file for processing on behalf of the caller.
+func (h handler) process(c echo.Context, res *Result) error {
+	if h.processor == nil {
+		return nil
+	}
+	var spender *int64
+	if id, ok := auth.FromContext(c); ok {
+		spender = id.SpenderScope()
+	}
+
+	id, err := h.processor.Process(c.Request().Context(), spender, *res)
+	if errors.Is(err, ErrDuplicate) {
+		res.Status = StatusDuplicate
+		res.UploadID = id
+		res.Error = err.Error()
+		return nil
+	}
+	if err != nil {
+		res.Status = StatusFailed
+		res.Error = "file was stored but could not be queued for processing"
+		return err
+	}
+	res.UploadID = id
+	return nil
+}
+
+const keyPrefix = "eslips/"
+
+var keyPattern = regexp.MustCompile(`^eslips/([0-9a-f]{64})(\.[a-z]+)$`)
+
+// ParseKey reports the content hash and type encoded in a key assigned by
+// Save, ok is false for any other key.
+func ParseKey(key string) (sha, contentType string, ok bool) {
+	m := keyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return "", "", false
+	}
+	contentType, ok = extTypes[m[2]]
+	return m[1], contentType, ok
+}
+
+func rejected(res Result, reason string) Result {
+	res.Status = StatusRejected
+	res.Error = reason
+	return res
+}
+
+func failed(res Result) Result {
+	res.Status = StatusFailed
+	res.Error = "file could not be stored"
+	return res
 }
@@ -1,32 +1,269 @@
 package eslip
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestUploadToS3(t *testing.T) {
-	t.Run("should able to upload image to S3 bucket", func(t *testing.T) {
-		f, _ := os.CreateTemp("", "eslip1.jpg")
-		defer f.Close()
-		defer os.Remove(f.Name())
+const (
+	png  = "\x89PNG\r\n\x1a\n slip"
+	jpeg = "\xff\xd8\xff\xe0 slip"
+	pdf  = "%PDF-1.7 slip"
+	heic = "\x00\x00\x00\x18ftypheic slip"
+)
+
+var limits = config.Upload{MaxFileSize: 1 << 10, MaxRequestSize: 1 << 20}
+
+type file struct{ name, content string }
+
+func newUploadRequest(t *testing.T, files ...file) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for _, f := range files {
+		part, err := w.CreateFormFile("images", f.name)
+		assert.NoError(t, err)
+		part.Write([]byte(f.content))
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+type response struct {
+	Message   string   `json:"message"`
+	Locations string   `json:"locations"`
+	Results   []Result `json:"results"`
+}
+
+func upload(t *testing.T, h *handler, req *http.Request) (*httptest.ResponseRecorder, response, error) {
+	e := echo.New()
+	defer e.Close()
+	rec := httptest.NewRecorder()
 
+	err := h.Upload(e.NewContext(req, rec))
+
+	var res response
+	if err == nil {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	}
+	return rec, res, err
+}
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+type failingStore struct{ storage.BlobStore }
+
+func (failingStore) Put(context.Context, string, io.Reader, int64, string) (string, error) {
+	return "", assert.AnError
+}
+
+// stubProcessor records the slips it was given and returns upload, or err.
+type stubProcessor struct {
+	upload  int64
+	err     error
+	spender *int64
+	slip    Result
+}
+
+func (s *stubProcessor) Process(_ context.Context, spender *int64, slip Result) (int64, error) {
+	s.spender, s.slip = spender, slip
+	return s.upload, s.err
+}
+
+func TestSniff(t *testing.T) {
+	cases := map[string]string{
+		png:  "image/png",
+		jpeg: "image/jpeg",
+		pdf:  "application/pdf",
+		heic: "image/heic",
+	}
+	for content, want := range cases {
+		got, _, ok := sniff([]byte(content))
+
+		assert.True(t, ok, want)
+		assert.Equal(t, want, got)
+	}
+
+	for _, content := range []string{"GIF89a", "<html>", "\x00\x00\x00\x18ftypmp42", ""} {
+		_, _, ok := sniff([]byte(content))
+
+		assert.False(t, ok, content)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	sum, contentType, ok := ParseKey("eslips/" + sha(png) + ".heic")
+
+	assert.True(t, ok)
+	assert.Equal(t, sha(png), sum)
+	assert.Equal(t, "image/heic", contentType)
+
+	for _, key := range []string{"eslips/" + sha(png) + ".gif", "eslips/abc.png", "other/" + sha(png) + ".png", "eslips/../" + sha(png) + ".png"} {
+		_, _, ok := ParseKey(key)
+
+		assert.False(t, ok, key)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	t.Run("should store images under their content hash", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := storage.NewLocal(dir)
+
+		rec, res, err := upload(t, New(limits, store, nil), newUploadRequest(t, file{"../../etc/passwd.png", png}, file{"slip.heic", heic}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Image uploaded successfully", res.Message)
+		assert.Equal(t, Result{
+			Filename:    "passwd.png",
+			Status:      StatusUploaded,
+			Key:         "eslips/" + sha(png) + ".png",
+			Location:    "eslips/" + sha(png) + ".png",
+			ContentType: "image/png",
+			Size:        int64(len(png)),
+			SHA256:      sha(png),
+		}, res.Results[0])
+		assert.Equal(t, "eslips/"+sha(heic)+".heic", res.Results[1].Key)
+		assert.Equal(t, res.Results[0].Location+","+res.Results[1].Location, res.Locations)
+
+		b, err := os.ReadFile(filepath.Join(dir, "eslips", sha(png)+".png"))
+		assert.NoError(t, err)
+		assert.Equal(t, png, string(b))
+	})
+
+	t.Run("should queue each stored image for processing", func(t *testing.T) {
+		store, _ := storage.NewLocal(t.TempDir())
+		uploads := &stubProcessor{upload: 9}
+		req := newUploadRequest(t, file{"slip.png", png})
 		e := echo.New()
 		defer e.Close()
-
-		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, auth.Identity{SpenderID: 1, Role: auth.RoleSpender})
+
+		err := New(limits, store, uploads).Upload(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"upload_id":9`)
+		assert.Equal(t, int64(1), *uploads.spender)
+		assert.Equal(t, "slip.png", uploads.slip.Filename)
+		assert.Equal(t, "image/png", uploads.slip.ContentType)
+	})
+
+	t.Run("should report slips uploaded before with their earlier upload", func(t *testing.T) {
+		store, _ := storage.NewLocal(t.TempDir())
+
+		rec, res, err := upload(t, New(limits, store, &stubProcessor{upload: 4, err: ErrDuplicate}), newUploadRequest(t, file{"slip.png", png}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, StatusDuplicate, res.Results[0].Status)
+		assert.Equal(t, int64(4), res.Results[0].UploadID)
+		assert.Equal(t, "eslips/"+sha(png)+".png", res.Results[0].Key)
+		assert.Empty(t, res.Locations)
+	})
+
+	t.Run("should report stored files that could not be queued", func(t *testing.T) {
+		store, _ := storage.NewLocal(t.TempDir())
+
+		rec, res, err := upload(t, New(limits, store, &stubProcessor{err: assert.AnError}), newUploadRequest(t, file{"slip.png", png}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		assert.Equal(t, StatusFailed, res.Results[0].Status)
+		assert.Zero(t, res.Results[0].UploadID)
+		assert.Empty(t, res.Locations)
+	})
+
+	t.Run("should report rejected files without aborting the batch", func(t *testing.T) {
+		store, _ := storage.NewLocal(t.TempDir())
 
-		loc, err := UploadToS3(c, "eslip1.jpg", f)
+		rec, res, err := upload(t, New(limits, store, nil), newUploadRequest(t,
+			file{"slip.pdf", pdf},
+			file{"page.html", "<html><body>slip</body></html>"},
+			file{"huge.jpg", jpeg + strings.Repeat("x", 1<<10)},
+			file{"empty.png", ""},
+		))
 
 		assert.NoError(t, err)
-		assert.Equal(t, "location/on/s3/bucket/eslip1.jpg", loc)
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		assert.Equal(t, "1 of 4 images uploaded", res.Message)
+		assert.Equal(t, StatusUploaded, res.Results[0].Status)
+		assert.Equal(t, "unsupported file type, expected PNG, JPEG, HEIC or PDF", res.Results[1].Error)
+		assert.Equal(t, "file exceeds the 1024 byte limit", res.Results[2].Error)
+		assert.Equal(t, "file is empty", res.Results[3].Error)
+		for _, r := range res.Results[1:] {
+			assert.Equal(t, StatusRejected, r.Status)
+			assert.Empty(t, r.Key)
+		}
+		assert.Equal(t, res.Results[0].Location, res.Locations)
 	})
 
+	t.Run("should report files the store failed to keep", func(t *testing.T) {
+		rec, res, err := upload(t, New(limits, failingStore{}, nil), newUploadRequest(t, file{"slip.png", png}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		assert.Equal(t, StatusFailed, res.Results[0].Status)
+		assert.Equal(t, "file could not be stored", res.Results[0].Error)
+		assert.Empty(t, res.Locations)
+	})
+
+	t.Run("should reject a request over the size limit", func(t *testing.T) {
+		req := newUploadRequest(t, file{"a.png", png + strings.Repeat("x", 600)}, file{"b.png", png + strings.Repeat("y", 600)})
+
+		_, _, err := upload(t, New(config.Upload{MaxFileSize: 1 << 10, MaxRequestSize: 1 << 10}, failingStore{}, nil), req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, problem.Status(err))
+	})
+
+	t.Run("should reject a streamed request over the size limit", func(t *testing.T) {
+		req := newUploadRequest(t, file{"a.png", png + strings.Repeat("x", 600)}, file{"b.png", png + strings.Repeat("y", 600)})
+		req.ContentLength = -1
+
+		_, _, err := upload(t, New(config.Upload{MaxFileSize: 1 << 10, MaxRequestSize: 1 << 10}, failingStore{}, nil), req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, problem.Status(err))
+	})
+
+	t.Run("should reject a request without images", func(t *testing.T) {
+		_, _, err := upload(t, New(limits, failingStore{}, nil), newUploadRequest(t))
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "no files")
+	})
+
+	t.Run("should reject a request that is not a form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+		_, _, err := upload(t, New(limits, failingStore{}, nil), req)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
 }
@@ -0,0 +1,45 @@
+package eslip
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// sniffLen is how many leading bytes sniff needs, the same window
+// http.DetectContentType looks at.
+const sniffLen = 512
+
+// heicBrands are the ISO base media file brands used by HEIC/HEIF images.
+var heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// extTypes maps the extension of every accepted type back to the type.
+var extTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".pdf":  "application/pdf",
+	".heic": "image/heic",
+}
+
+// sniff reports the content type and file extension of an accepted e-slip
+// from its leading bytes. The type the client declared is never trusted.
+func sniff(head []byte) (contentType, ext string, ok bool) {
+	switch http.DetectContentType(head) {
+	case "image/png":
+		return "image/png", ".png", true
+	case "image/jpeg":
+		return "image/jpeg", ".jpg", true
+	case "application/pdf":
+		return "application/pdf", ".pdf", true
+	}
+
+	// HEIC starts with an ftyp box: size, "ftyp", then the major brand.
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		for _, brand := range heicBrands {
+			if string(head[8:12]) == brand {
+				return "image/heic", ".heic", true
+			}
+		}
+	}
+
+	return "", "", false
+}
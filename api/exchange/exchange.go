@@ -0,0 +1,238 @@
+package exchange
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const dateLayout = "2006-01-02"
+
+// Rate converts one unit of FromCurrency into Rate units of ToCurrency for
+// transactions dated on or after EffectiveDate, until a newer rate applies.
+type Rate struct {
+	ID            int64       `json:"id"`
+	FromCurrency  string      `json:"from_currency" validate:"required,currency"`
+	ToCurrency    string      `json:"to_currency" validate:"required,currency"`
+	Rate          json.Number `json:"rate" validate:"required"`
+	EffectiveDate string      `json:"effective_date" validate:"required,datetime=2006-01-02"`
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db}
+}
+
+const (
+	lStmt = `SELECT id, from_currency, to_currency, rate, effective_date FROM exchange_rate`
+	uStmt = `INSERT INTO exchange_rate (from_currency, to_currency, rate, effective_date) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (from_currency, to_currency, effective_date) DO UPDATE SET rate = EXCLUDED.rate RETURNING id;`
+)
+
+func (h handler) GetAll(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var conds []string
+	var args []any
+	for _, param := range []string{"from_currency", "to_currency"} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+		code, err := money.NormalizeCurrency(v)
+		if err != nil {
+			return problem.BadRequest(err)
+		}
+		args = append(args, code)
+		conds = append(conds, fmt.Sprintf("%s = $%d", param, len(args)))
+	}
+
+	query := lStmt
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY effective_date DESC, from_currency, to_currency"
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return err
+	}
+	defer rows.Close()
+
+	rates := []Rate{}
+	for rows.Next() {
+		var r Rate
+		var date time.Time
+		if err := rows.Scan(&r.ID, &r.FromCurrency, &r.ToCurrency, &r.Rate, &date); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return err
+		}
+		r.EffectiveDate = date.Format(dateLayout)
+		rates = append(rates, r)
+	}
+
+	return c.JSON(http.StatusOK, rates)
+}
+
+// Upsert stores a JSON array of rates, replacing the rate of any pair that
+// already has one for the same effective date.
+func (h handler) Upsert(c echo.Context) error {
+	logger := mlog.L(c)
+
+	var rates []Rate
+	if err := c.Bind(&rates); err != nil {
+		return problem.BadRequest(err)
+	}
+	for i := range rates {
+		rates[i].FromCurrency = strings.ToUpper(strings.TrimSpace(rates[i].FromCurrency))
+		rates[i].ToCurrency = strings.ToUpper(strings.TrimSpace(rates[i].ToCurrency))
+	}
+	if err := c.Validate(rates); err != nil {
+		return err
+	}
+	for i := range rates {
+		if err := normalize(&rates[i]); err != nil {
+			return problem.BadRequest(fmt.Errorf("rate %d: %w", i, err))
+		}
+	}
+
+	if err := h.store(c.Request().Context(), rates); err != nil {
+		logger.Error("exec error", zap.Error(err))
+		return err
+	}
+
+	return c.JSON(http.StatusOK, rates)
+}
+
+// Import reads rates from an uploaded CSV file with the header
+// from_currency,to_currency,rate,effective_date. Either every row is stored
+// or, when one is invalid, none is.
+func (h handler) Import(c echo.Context) error {
+	logger := mlog.L(c)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	defer f.Close()
+
+	rates, err := readCSV(f)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	if err := h.store(c.Request().Context(), rates); err != nil {
+		logger.Error("exec error", zap.Error(err))
+		return err
+	}
+
+	logger.Info("import successfully", zap.Int("rates", len(rates)))
+	return c.JSON(http.StatusOK, map[string]int{"imported": len(rates)})
+}
+
+func (h handler) store(ctx context.Context, rates []Rate) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, r := range rates {
+		err := tx.QueryRowContext(ctx, uStmt, r.FromCurrency, r.ToCurrency, r.Rate.String(), r.EffectiveDate).Scan(&rates[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func readCSV(r io.Reader) ([]Rate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if strings.Join(header, ",") != "from_currency,to_currency,rate,effective_date" {
+		return nil, errors.New("header must be from_currency,to_currency,rate,effective_date")
+	}
+
+	var rates []Rate
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r := Rate{FromCurrency: rec[0], ToCurrency: rec[1], Rate: json.Number(rec[2]), EffectiveDate: rec[3]}
+		if err := normalize(&r); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, r)
+	}
+
+	if len(rates) == 0 {
+		return nil, errors.New("no rates to import")
+	}
+	return rates, nil
+}
+
+// normalize validates r and canonicalises its currency codes.
+func normalize(r *Rate) error {
+	if strings.TrimSpace(r.FromCurrency) == "" || strings.TrimSpace(r.ToCurrency) == "" {
+		return errors.New("from_currency and to_currency are required")
+	}
+
+	var err error
+	if r.FromCurrency, err = money.NormalizeCurrency(r.FromCurrency); err != nil {
+		return err
+	}
+	if r.ToCurrency, err = money.NormalizeCurrency(r.ToCurrency); err != nil {
+		return err
+	}
+	if r.FromCurrency == r.ToCurrency {
+		return errors.New("from_currency and to_currency must differ")
+	}
+
+	rate, ok := new(big.Rat).SetString(r.Rate.String())
+	if !ok || rate.Sign() <= 0 {
+		return fmt.Errorf("invalid rate %q: must be a positive number", r.Rate)
+	}
+	if _, frac, _ := strings.Cut(r.Rate.String(), "."); len(frac) > 8 || strings.ContainsAny(r.Rate.String(), "eE") {
+		return fmt.Errorf("invalid rate %q: must have at most eight decimals", r.Rate)
+	}
+
+	if _, err := time.Parse(dateLayout, r.EffectiveDate); err != nil {
+		return fmt.Errorf("invalid effective_date %q: must be YYYY-MM-DD", r.EffectiveDate)
+	}
+	return nil
+}
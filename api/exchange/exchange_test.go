@@ -0,0 +1,236 @@
+package exchange
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllRates(t *testing.T) {
+	t.Run("get rates filtered by currency", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/exchange-rates?from_currency=jpy", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"id", "from_currency", "to_currency", "rate", "effective_date"}).
+			AddRow(1, "JPY", "THB", []byte("0.23450000"), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+		mock.ExpectQuery(lStmt + ` WHERE from_currency = $1 ORDER BY effective_date DESC, from_currency, to_currency`).
+			WithArgs("JPY").
+			WillReturnRows(rows)
+
+		h := New(db)
+		err := h.GetAll(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"id": 1, "from_currency": "JPY", "to_currency": "THB", "rate": 0.2345, "effective_date": "2024-05-01"}]`, rec.Body.String())
+	})
+
+	t.Run("get rates failed when currency is unknown", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/exchange-rates?to_currency=ABC", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.GetAll(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+}
+
+func TestUpsertRates(t *testing.T) {
+	t.Run("store rates in one transaction", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/exchange-rates", strings.NewReader(`[
+			{"from_currency": "usd", "to_currency": "THB", "rate": 36.5, "effective_date": "2024-05-01"},
+			{"from_currency": "JPY", "to_currency": "THB", "rate": "0.2345", "effective_date": "2024-05-01"}
+		]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(uStmt).WithArgs("USD", "THB", "36.5", "2024-05-01").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(uStmt).WithArgs("JPY", "THB", "0.2345", "2024-05-01").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.Upsert(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[
+			{"id": 1, "from_currency": "USD", "to_currency": "THB", "rate": 36.5, "effective_date": "2024-05-01"},
+			{"id": 2, "from_currency": "JPY", "to_currency": "THB", "rate": 0.2345, "effective_date": "2024-05-01"}
+		]`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("store failed on database", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/exchange-rates", strings.NewReader(`[
+			{"from_currency": "USD", "to_currency": "THB", "rate": 36.5, "effective_date": "2024-05-01"}
+		]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(uStmt).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		h := New(db)
+		err := h.Upsert(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	invalid := map[string]string{
+		"bad request body":      `{ bad request body }`,
+		"unknown currency":      `[{"from_currency": "ABC", "to_currency": "THB", "rate": 1, "effective_date": "2024-05-01"}]`,
+		"missing currency":      `[{"to_currency": "THB", "rate": 1, "effective_date": "2024-05-01"}]`,
+		"same currencies":       `[{"from_currency": "THB", "to_currency": "THB", "rate": 1, "effective_date": "2024-05-01"}]`,
+		"zero rate":             `[{"from_currency": "USD", "to_currency": "THB", "rate": 0, "effective_date": "2024-05-01"}]`,
+		"too precise rate":      `[{"from_currency": "USD", "to_currency": "THB", "rate": 0.123456789, "effective_date": "2024-05-01"}]`,
+		"malformed date":        `[{"from_currency": "USD", "to_currency": "THB", "rate": 1, "effective_date": "01/05/2024"}]`,
+		"exponent rate literal": `[{"from_currency": "USD", "to_currency": "THB", "rate": 1e2, "effective_date": "2024-05-01"}]`,
+	}
+	for name, body := range invalid {
+		t.Run("reject "+name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = validate.New()
+			defer e.Close()
+
+			req := httptest.NewRequest(http.MethodPut, "/exchange-rates", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := New(nil)
+			err := h.Upsert(c)
+
+			assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		})
+	}
+}
+
+func newImportRequest(t *testing.T, content string) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", "rates.csv")
+	assert.NoError(t, err)
+	part.Write([]byte(content))
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/exchange-rates/import", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func TestImportRates(t *testing.T) {
+	t.Run("import rates from csv", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := newImportRequest(t, "from_currency,to_currency,rate,effective_date\nUSD,THB,36.5,2024-05-01\nJPY, THB, 0.2345, 2024-05-01\n")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(uStmt).WithArgs("USD", "THB", "36.5", "2024-05-01").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(uStmt).WithArgs("JPY", "THB", "0.2345", "2024-05-01").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"imported": 2}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("import failed with line number of invalid row", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := newImportRequest(t, "from_currency,to_currency,rate,effective_date\nUSD,THB,36.5,2024-05-01\nJPY,THB,-1,2024-05-01\n")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Import(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "line 3")
+	})
+
+	t.Run("import failed when header is wrong", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := newImportRequest(t, "from,to,rate,date\nUSD,THB,36.5,2024-05-01\n")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Import(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("import failed without file", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/exchange-rates/import", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Import(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+}
@@ -0,0 +1,62 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// ErrUnsupported is returned for slips a provider cannot read, such as PDFs
+// given to an image-only OCR.
+var ErrUnsupported = errors.New("unsupported slip")
+
+// OCR turns a slip into plain text, one line per printed line.
+type OCR interface {
+	Text(ctx context.Context, contentType string, r io.Reader) (string, error)
+}
+
+// Extractor reads a draft transaction from a slip.
+type Extractor interface {
+	Extract(ctx context.Context, contentType string, r io.Reader) (Draft, error)
+}
+
+// Draft is what could be read from a slip. Fields that were not found are
+// nil or empty with a confidence of 0.
+type Draft struct {
+	Amount     *money.Amount `json:"amount"`
+	Date       *time.Time    `json:"date"`
+	Merchant   string        `json:"merchant"`
+	Confidence Confidence    `json:"confidence"`
+}
+
+// Confidence scores each field of a Draft between 0 and 1.
+type Confidence struct {
+	Amount   float64 `json:"amount"`
+	Date     float64 `json:"date"`
+	Merchant float64 `json:"merchant"`
+}
+
+// New returns the extractor selected by cfg.OCR, nil when extraction is
+// disabled. It fails when the provider's command is not installed.
+func New(cfg config.Extract) (Extractor, error) {
+	switch cfg.OCR {
+	case "":
+		return nil, nil
+	case "tesseract":
+		// the container image does not ship tesseract, fail early rather
+		// than on every slip
+		path, err := exec.LookPath(cfg.TesseractPath)
+		if err != nil {
+			return nil, fmt.Errorf("ocr provider tesseract needs the %s command: %w", cfg.TesseractPath, err)
+		}
+		return NewRules(NewTesseract(path, cfg.TesseractLangs)), nil
+	default:
+		return nil, fmt.Errorf("unsupported ocr provider %q, must be empty or tesseract", cfg.OCR)
+	}
+}
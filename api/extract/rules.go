@@ -0,0 +1,199 @@
+package extract
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// Confidence given to a field depending on how it was found.
+const (
+	labelled   = 0.9
+	suffixed   = 0.7
+	ambiguous  = 0.6
+	positional = 0.4
+	guessed    = 0.3
+)
+
+// Rules reads drafts from OCR text with patterns matching the wording of
+// Thai bank transfer slips and common English receipts.
+type Rules struct {
+	ocr OCR
+	now func() time.Time
+}
+
+func NewRules(ocr OCR) *Rules {
+	return &Rules{ocr: ocr, now: time.Now}
+}
+
+func (x *Rules) Extract(ctx context.Context, contentType string, r io.Reader) (Draft, error) {
+	text, err := x.ocr.Text(ctx, contentType, r)
+	if err != nil {
+		return Draft{}, err
+	}
+	return x.Parse(text), nil
+}
+
+// Parse reads a draft from the text of a slip.
+func (x *Rules) Parse(text string) Draft {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	var d Draft
+	d.Amount, d.Confidence.Amount = amount(lines)
+	d.Date, d.Confidence.Date = x.date(lines)
+	d.Merchant, d.Confidence.Merchant = merchant(lines)
+	return d
+}
+
+const number = `([0-9]{1,3}(?:,[0-9]{3})+(?:\.[0-9]{1,2})?|[0-9]+(?:\.[0-9]{1,2})?)`
+
+var (
+	amountLabel  = regexp.MustCompile(`(?i)(?:amount|total|จำนวนเงิน|ยอดเงิน|ยอดชำระ|ยอดรวม)\s*[:：]?\s*(?:THB|฿)?\s*` + number)
+	amountSuffix = regexp.MustCompile(`(?i)` + number + `\s*(?:บาท|THB|฿)`)
+	decimal      = regexp.MustCompile(`[0-9]{1,3}(?:,[0-9]{3})+\.[0-9]{2}|[0-9]+\.[0-9]{2}`)
+)
+
+// amount prefers a labelled amount, then one followed by a currency and
+// finally the largest number with two decimals.
+func amount(lines []string) (*money.Amount, float64) {
+	for _, p := range []struct {
+		re         *regexp.Regexp
+		confidence float64
+	}{{amountLabel, labelled}, {amountSuffix, suffixed}} {
+		for _, l := range lines {
+			if m := p.re.FindStringSubmatch(l); m != nil {
+				if a, err := money.Parse(strings.ReplaceAll(m[1], ",", "")); err == nil && a > 0 {
+					return &a, p.confidence
+				}
+			}
+		}
+	}
+
+	var best *money.Amount
+	for _, l := range lines {
+		for _, m := range decimal.FindAllString(l, -1) {
+			if a, err := money.Parse(strings.ReplaceAll(m, ",", "")); err == nil && (best == nil || a > *best) {
+				best = &a
+			}
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best, positional
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	"ม.ค.": time.January, "ก.พ.": time.February, "มี.ค.": time.March, "เม.ย.": time.April,
+	"พ.ค.": time.May, "มิ.ย.": time.June, "ก.ค.": time.July, "ส.ค.": time.August,
+	"ก.ย.": time.September, "ต.ค.": time.October, "พ.ย.": time.November, "ธ.ค.": time.December,
+}
+
+var (
+	isoDate     = regexp.MustCompile(`\b([0-9]{4})-([0-9]{2})-([0-9]{2})\b`)
+	namedDate   = regexp.MustCompile(`(?i)\b([0-9]{1,2})\s+([a-z]{3})[a-z]*\.?\s+([0-9]{2,4})\b|([0-9]{1,2})\s+([ก-๙]{1,3}\.[ก-๙]{1,2}\.)\s*([0-9]{2,4})`)
+	numericDate = regexp.MustCompile(`\b([0-9]{1,2})[/.-]([0-9]{1,2})[/.-]([0-9]{2,4})\b`)
+)
+
+// date reads the first date of the slip. Numeric dates are read day first,
+// as printed in Thailand, and Buddhist Era years are converted.
+func (x *Rules) date(lines []string) (*time.Time, float64) {
+	for _, l := range lines {
+		if m := isoDate.FindStringSubmatch(l); m != nil {
+			if t, ok := x.day(m[1], m[2], m[3]); ok {
+				return &t, labelled
+			}
+		}
+		if m := namedDate.FindStringSubmatch(l); m != nil {
+			d, name, y := m[1], m[2], m[3]
+			if d == "" {
+				d, name, y = m[4], m[5], m[6]
+			}
+			if month, ok := months[strings.ToLower(name)]; ok {
+				if t, ok := x.day(y, strconv.Itoa(int(month)), d); ok {
+					return &t, labelled
+				}
+			}
+		}
+		if m := numericDate.FindStringSubmatch(l); m != nil {
+			if t, ok := x.day(m[3], m[2], m[1]); ok {
+				return &t, ambiguous
+			}
+		}
+	}
+	return nil, 0
+}
+
+func (x *Rules) day(year, month, day string) (time.Time, bool) {
+	y, _ := strconv.Atoi(year)
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	y = x.year(y, len(year))
+	if m < 1 || m > 12 || d < 1 || d > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if t.Day() != d {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// year resolves two digit and Buddhist Era years to the closest year of the
+// Common Era.
+func (x *Rules) year(y, digits int) int {
+	if digits == 4 {
+		if y > 2400 {
+			return y - 543
+		}
+		return y
+	}
+
+	now := x.now().Year()
+	ce, be := 2000+y, 2500+y-543
+	if abs(be-now) < abs(ce-now) {
+		return be
+	}
+	return ce
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+var (
+	merchantLabel = regexp.MustCompile(`(?i)^(?:to|merchant|payee|ไปยัง|ถึง|ผู้รับเงิน|ผู้รับ)(?:\s*[:：]\s*|\s+)(.+)$`)
+	noise         = regexp.MustCompile(`^[0-9\s,./:-]*$`)
+)
+
+// merchant prefers a labelled payee and otherwise guesses the first line
+// that is not only digits, which is usually the shop name on receipts.
+func merchant(lines []string) (string, float64) {
+	for _, l := range lines {
+		if m := merchantLabel.FindStringSubmatch(l); m != nil {
+			return strings.TrimSpace(m[1]), labelled
+		}
+	}
+	for _, l := range lines {
+		if !noise.MatchString(l) {
+			return l, guessed
+		}
+	}
+	return "", 0
+}
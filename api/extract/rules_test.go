@@ -0,0 +1,147 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOCR returns fixed text, or its error, for any slip.
+type fakeOCR struct {
+	text string
+	err  error
+}
+
+func (f fakeOCR) Text(_ context.Context, _ string, r io.Reader) (string, error) {
+	io.Copy(io.Discard, r)
+	return f.text, f.err
+}
+
+func newRules(text string) *Rules {
+	x := NewRules(fakeOCR{text: text})
+	x.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return x
+}
+
+func amountOf(s string) *money.Amount {
+	a, _ := money.Parse(s)
+	return &a
+}
+
+func day(y int, m time.Month, d int) *time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestExtract(t *testing.T) {
+	cases := map[string]struct {
+		text string
+		want Draft
+	}{
+		"thai transfer slip": {
+			text: `โอนเงินสำเร็จ
+				12 พ.ค. 67 14:05 น.
+				นาย สมชาย ใจดี
+				ไปยัง ร้านกาแฟดอยช้าง
+				จำนวนเงิน 1,250.50 บาท`,
+			want: Draft{
+				Amount: amountOf("1250.50"), Date: day(2024, time.May, 12), Merchant: "ร้านกาแฟดอยช้าง",
+				Confidence: Confidence{Amount: labelled, Date: labelled, Merchant: labelled},
+			},
+		},
+		"english receipt": {
+			text: `STARBUCKS SIAM PARAGON
+				Date: 2024-05-03 09:12
+				Latte            120.00
+				Croissant         95.00
+				TOTAL THB 215.00`,
+			want: Draft{
+				Amount: amountOf("215"), Date: day(2024, time.May, 3), Merchant: "STARBUCKS SIAM PARAGON",
+				Confidence: Confidence{Amount: labelled, Date: labelled, Merchant: guessed},
+			},
+		},
+		"unlabelled slip": {
+			text: `03/05/2567
+				7-Eleven
+				45.00 บาท`,
+			want: Draft{
+				Amount: amountOf("45"), Date: day(2024, time.May, 3), Merchant: "7-Eleven",
+				Confidence: Confidence{Amount: suffixed, Date: ambiguous, Merchant: guessed},
+			},
+		},
+		"bare numbers": {
+			text: `12.50
+				1,020.75
+				31/02/24`,
+			want: Draft{
+				Amount:     amountOf("1020.75"),
+				Confidence: Confidence{Amount: positional},
+			},
+		},
+		"english month and short year": {
+			text: "Payee: Grab Food\n3 Jun 24\nAmount 89",
+			want: Draft{
+				Amount: amountOf("89"), Date: day(2024, time.June, 3), Merchant: "Grab Food",
+				Confidence: Confidence{Amount: labelled, Date: labelled, Merchant: labelled},
+			},
+		},
+		"nothing readable": {
+			text: "",
+			want: Draft{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d, err := newRules(tc.text).Extract(context.Background(), "image/png", strings.NewReader("png"))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, d)
+		})
+	}
+
+	t.Run("report ocr failures", func(t *testing.T) {
+		x := NewRules(fakeOCR{err: ErrUnsupported})
+
+		_, err := x.Extract(context.Background(), "application/pdf", strings.NewReader("pdf"))
+
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+// command installs an executable standing in for a provider's command.
+func command(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "cmd")
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755))
+	return path
+}
+
+func TestNew(t *testing.T) {
+	x, err := New(config.Extract{})
+	assert.NoError(t, err)
+	assert.Nil(t, x)
+
+	x, err = New(config.Extract{OCR: "tesseract", TesseractPath: command(t), TesseractLangs: "eng"})
+	assert.NoError(t, err)
+	assert.NotNil(t, x)
+
+	_, err = New(config.Extract{OCR: "tesseract", TesseractPath: filepath.Join(t.TempDir(), "tesseract"), TesseractLangs: "eng"})
+	assert.ErrorContains(t, err, "needs the")
+
+	_, err = New(config.Extract{OCR: "textract"})
+	assert.Error(t, err)
+}
+
+func TestTesseractRejectsPDF(t *testing.T) {
+	_, err := NewTesseract("tesseract", "eng").Text(context.Background(), "application/pdf", strings.NewReader("%PDF"))
+
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
@@ -0,0 +1,36 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Tesseract runs the tesseract command line OCR on image slips.
+type Tesseract struct {
+	path  string
+	langs string
+}
+
+func NewTesseract(path, langs string) *Tesseract {
+	return &Tesseract{path: path, langs: langs}
+}
+
+func (t *Tesseract) Text(ctx context.Context, contentType string, r io.Reader) (string, error) {
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.path, "stdin", "stdout", "-l", t.langs)
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,241 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+
+	// lease is how long a key stays claimed by a request that has not
+	// answered yet, so a crashed server does not hold it until TTL.
+	lease = 5 * time.Minute
+)
+
+// Keys records the responses of requests sent with an Idempotency-Key
+// header, keyed per caller, so retries get the first response back instead
+// of repeating its writes.
+type Keys struct {
+	db  *sql.DB
+	cfg config.Idempotency
+}
+
+func New(db *sql.DB, cfg config.Idempotency) *Keys {
+	return &Keys{db, cfg}
+}
+
+const (
+	// cStmt claims a key for a request, taking over an expired claim. It
+	// returns no row while the key is live.
+	cStmt = `INSERT INTO idempotency_key (owner, key, fingerprint, expires_at) VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+	ON CONFLICT (owner, key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = '', body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+	WHERE idempotency_key.expires_at < now()
+	RETURNING key;`
+	gStmt = `SELECT fingerprint, status, content_type, body FROM idempotency_key WHERE owner = $1 AND key = $2`
+	sStmt = `UPDATE idempotency_key SET status = $3, content_type = $4, body = $5, expires_at = now() + $6 * interval '1 millisecond' WHERE owner = $1 AND key = $2;`
+	dStmt = `DELETE FROM idempotency_key WHERE owner = $1 AND key = $2;`
+	pStmt = `DELETE FROM idempotency_key WHERE expires_at < now();`
+)
+
+// Middleware makes the route safe to retry with an Idempotency-Key header.
+// The first request runs and its response is kept for TTL, later requests
+// with the key get that response replayed, or 422 when their method, path or
+// body differ. Server errors are not kept so they can be retried. Bodies are
+// buffered up to limit bytes. It must run after auth.Middleware, if any.
+func (k *Keys) Middleware(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(HeaderKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return problem.BadRequest(fmt.Errorf("%s must be at most %d characters", HeaderKey, maxKeyLength))
+			}
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+			if err != nil {
+				return problem.BadRequest(err)
+			}
+			if int64(len(body)) > limit {
+				return problem.TooLarge(fmt.Sprintf("request exceeds the %d byte limit", limit))
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := req.Context()
+			owner := owner(c)
+			fp := fingerprint(req, body)
+			var claimed string
+			err = k.db.QueryRowContext(ctx, cStmt, owner, key, fp, lease.Milliseconds()).Scan(&claimed)
+			if errors.Is(err, sql.ErrNoRows) {
+				return k.replay(c, owner, key, fp)
+			}
+			if err != nil {
+				return err
+			}
+
+			rec := &recorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// the response is out, keep it even if the client went away
+			ctx = context.WithoutCancel(ctx)
+			res := c.Response()
+			if res.Status >= http.StatusInternalServerError || !res.Committed {
+				_, err = k.db.ExecContext(ctx, dStmt, owner, key)
+			} else {
+				_, err = k.db.ExecContext(ctx, sStmt, owner, key, res.Status, res.Header().Get(echo.HeaderContentType), rec.body.Bytes(), k.cfg.TTL.Milliseconds())
+			}
+			if err != nil {
+				mlog.L(c).Error("record idempotent response", zap.String("key", key), zap.Error(err))
+			}
+			return nil
+		}
+	}
+}
+
+func (k *Keys) replay(c echo.Context, owner, key, fp string) error {
+	var stored string
+	var status sql.NullInt64
+	var contentType string
+	var body []byte
+	err := k.db.QueryRowContext(c.Request().Context(), gStmt, owner, key).Scan(&stored, &status, &contentType, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.Conflict(fmt.Sprintf("request with this %s is still in progress", HeaderKey))
+	}
+	if err != nil {
+		return err
+	}
+	if stored != fp {
+		return problem.Unprocessable(fmt.Errorf("%s was already used for a different request", HeaderKey))
+	}
+	if !status.Valid {
+		return problem.Conflict(fmt.Sprintf("request with this %s is still in progress", HeaderKey))
+	}
+
+	c.Response().Header().Set(HeaderReplayed, "true")
+	return c.Blob(int(status.Int64), contentType, body)
+}
+
+// Purge deletes expired keys.
+func (k *Keys) Purge(ctx context.Context) (int64, error) {
+	res, err := k.db.ExecContext(ctx, pStmt)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Run purges expired keys every PurgeInterval until ctx is cancelled.
+func (k *Keys) Run(ctx context.Context, logger *zap.Logger) {
+	t := time.NewTicker(k.cfg.PurgeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		n, err := k.Purge(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("purge idempotency keys", zap.Error(err))
+			continue
+		}
+		logger.Info("purged idempotency keys", zap.Int64("count", n))
+	}
+}
+
+// owner scopes keys to the caller, so callers cannot replay each other's
+// responses. Services are told apart by their API key and unauthenticated
+// callers by their address, which the server must not take from headers.
+func owner(c echo.Context) string {
+	id, ok := auth.FromContext(c)
+	if !ok {
+		return "anonymous:" + c.RealIP()
+	}
+	if id.KeyID != 0 {
+		return fmt.Sprintf("key:%d", id.KeyID)
+	}
+	return fmt.Sprintf("%s:%d", id.Role, id.SpenderID)
+}
+
+// fingerprint identifies a request by its method, path and body. Multipart
+// bodies are read part by part since clients pick a new boundary for every
+// retry.
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.Path)
+	if !hashParts(h, req.Header.Get(echo.HeaderContentType), body) {
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashParts(h hash.Hash, contentType string, body []byte) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return false
+	}
+
+	parts := sha256.New()
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return false
+		}
+		fmt.Fprintf(parts, "%q %q %q\n", p.FormName(), p.FileName(), p.Header.Get(echo.HeaderContentType))
+		content := sha256.New()
+		if _, err := io.Copy(content, p); err != nil {
+			return false
+		}
+		parts.Write(content.Sum(nil))
+	}
+	h.Write(parts.Sum(nil))
+	return true
+}
+
+// recorder keeps a copy of the response body written through it.
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,248 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	cfg     = config.Idempotency{TTL: time.Hour, PurgeInterval: time.Hour}
+	spender = auth.Identity{SpenderID: 1, Role: auth.RoleSpender}
+	body    = `{"amount": 100}`
+)
+
+func newRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	return req
+}
+
+// serve runs req through the middleware in front of handler, counting the
+// handler's calls.
+func serve(t *testing.T, k *Keys, req *http.Request, handler echo.HandlerFunc) (*httptest.ResponseRecorder, int, error) {
+	e := echo.New()
+	e.Validator = validate.New()
+	e.HTTPErrorHandler = problem.ErrorHandler
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	auth.SetIdentity(c, spender)
+
+	calls := 0
+	err := k.Middleware(1 << 10)(func(c echo.Context) error {
+		calls++
+		return handler(c)
+	})(c)
+	return rec, calls, err
+}
+
+func created(c echo.Context) error {
+	return c.JSON(http.StatusCreated, map[string]int{"id": 7})
+}
+
+func newKeys(t *testing.T) (*Keys, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return New(db, cfg), mock
+}
+
+func stored(fp string, status driver.Value, body string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body"}).
+		AddRow(fp, status, echo.MIMEApplicationJSON, []byte(body))
+}
+
+func TestMiddleware(t *testing.T) {
+	fp := fingerprint(newRequest("", body), []byte(body))
+
+	t.Run("pass requests without a key through", func(t *testing.T) {
+		k, mock := newKeys(t)
+
+		rec, calls, err := serve(t, k, newRequest("", body), created)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("record the response of the first request", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", fp, lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+		mock.ExpectExec(sStmt).WithArgs("spender:1", "abc", http.StatusCreated, echo.MIMEApplicationJSON, []byte(`{"id":7}`+"\n"), time.Hour.Milliseconds()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		rec, calls, err := serve(t, k, newRequest("abc", body), func(c echo.Context) error {
+			b := new(bytes.Buffer)
+			_, err := b.ReadFrom(c.Request().Body)
+			assert.NoError(t, err)
+			assert.Equal(t, body, b.String())
+			return created(c)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderReplayed))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("record client errors", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", fp, lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+		mock.ExpectExec(sStmt).WithArgs("spender:1", "abc", http.StatusConflict, problem.MIMEApplicationProblemJSON, sqlmock.AnyArg(), time.Hour.Milliseconds()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		rec, _, err := serve(t, k, newRequest("abc", body), func(echo.Context) error {
+			return problem.Conflict("transaction is already recorded")
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("release the key on server errors", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", fp, lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+		mock.ExpectExec(dStmt).WithArgs("spender:1", "abc").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		rec, _, err := serve(t, k, newRequest("abc", body), func(echo.Context) error {
+			return assert.AnError
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("replay the recorded response", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", fp, lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(gStmt).WithArgs("spender:1", "abc").WillReturnRows(stored(fp, 201, `{"id":7}`))
+
+		rec, calls, err := serve(t, k, newRequest("abc", body), created)
+
+		assert.NoError(t, err)
+		assert.Zero(t, calls)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get(HeaderReplayed))
+		assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `{"id":7}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reject a key reused for another request", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", sqlmock.AnyArg(), lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(gStmt).WithArgs("spender:1", "abc").WillReturnRows(stored(fp, 201, `{"id":7}`))
+
+		_, calls, err := serve(t, k, newRequest("abc", `{"amount": 200}`), created)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.Zero(t, calls)
+	})
+
+	t.Run("reject a retry while the first request runs", func(t *testing.T) {
+		k, mock := newKeys(t)
+		mock.ExpectQuery(cStmt).WithArgs("spender:1", "abc", fp, lease.Milliseconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(gStmt).WithArgs("spender:1", "abc").WillReturnRows(stored(fp, nil, ""))
+
+		_, calls, err := serve(t, k, newRequest("abc", body), created)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+		assert.Zero(t, calls)
+	})
+
+	t.Run("reject keys that are too long", func(t *testing.T) {
+		k, _ := newKeys(t)
+
+		_, _, err := serve(t, k, newRequest(strings.Repeat("k", 256), body), created)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("reject bodies over the limit", func(t *testing.T) {
+		k, _ := newKeys(t)
+
+		_, _, err := serve(t, k, newRequest("abc", strings.Repeat("x", 1<<10+1)), created)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, problem.Status(err))
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	upload := func(boundary, content string) *http.Request {
+		b := &bytes.Buffer{}
+		w := multipart.NewWriter(b)
+		w.SetBoundary(boundary)
+		part, _ := w.CreateFormFile("images", "slip.png")
+		part.Write([]byte(content))
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", b)
+		req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+		return req
+	}
+	fp := func(req *http.Request) string {
+		b := new(bytes.Buffer)
+		b.ReadFrom(req.Body)
+		return fingerprint(req, b.Bytes())
+	}
+
+	assert.Equal(t, fp(upload("first", "png")), fp(upload("second", "png")))
+	assert.NotEqual(t, fp(upload("first", "png")), fp(upload("first", "jpg")))
+	assert.NotEqual(t, fingerprint(newRequest("", body), []byte(body)), fingerprint(httptest.NewRequest(http.MethodPost, "/api/v1/spenders", nil), []byte(body)))
+}
+
+func TestOwner(t *testing.T) {
+	ownerOf := func(id *auth.Identity) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/spenders", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+		e := echo.New()
+		e.IPExtractor = echo.ExtractIPDirect()
+		c := e.NewContext(req, httptest.NewRecorder())
+		if id != nil {
+			auth.SetIdentity(c, *id)
+		}
+		return owner(c)
+	}
+
+	assert.Equal(t, "spender:1", ownerOf(&spender))
+	assert.Equal(t, "key:3", ownerOf(&auth.Identity{Role: auth.RoleService, KeyID: 3}))
+	assert.NotEqual(t, ownerOf(&auth.Identity{Role: auth.RoleService, KeyID: 3}), ownerOf(&auth.Identity{Role: auth.RoleService, KeyID: 4}))
+	assert.Equal(t, "anonymous:192.0.2.1", ownerOf(nil))
+}
+
+func TestPurge(t *testing.T) {
+	k, mock := newKeys(t)
+	mock.ExpectExec(pStmt).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := k.Purge(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
@@ -26,6 +26,8 @@ func logParentID(c echo.Context, logger *zap.Logger) *zap.Logger {
 		xParent = uuid.NewString()
 	}
 	xSpan := uuid.NewString()
+	c.Set(parentKey, xParent)
+	c.Set(spanKey, xSpan)
 	return logger.With(zap.String("parent-id", xParent),
 		zap.String("span-id", xSpan))
 }
@@ -36,3 +36,21 @@ func TestUnsetLogMiddleware(t *testing.T) {
 
 	assert.IsType(t, &zap.Logger{}, L(ctx))
 }
+
+func TestMiddlewareIDs(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Parent-ID", "parent-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var parent, span string
+	h := Middleware(zap.NewNop())(func(c echo.Context) error {
+		parent, span = IDs(c)
+		return nil
+	})
+
+	assert.NoError(t, h(c))
+	assert.Equal(t, "parent-1", parent)
+	assert.NotEmpty(t, span)
+}
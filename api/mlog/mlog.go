@@ -5,7 +5,11 @@ import (
 	"go.uber.org/zap"
 )
 
-const key = "logger"
+const (
+	key       = "logger"
+	parentKey = "parent-id"
+	spanKey   = "span-id"
+)
 
 func L(c echo.Context) *zap.Logger {
 	switch logger := c.Get(key).(type) {
@@ -15,3 +19,11 @@ func L(c echo.Context) *zap.Logger {
 		return zap.NewNop()
 	}
 }
+
+// IDs returns the parent and span ids the middleware assigned to the request,
+// empty when the middleware did not run.
+func IDs(c echo.Context) (parent, span string) {
+	parent, _ = c.Get(parentKey).(string)
+	span, _ = c.Get(spanKey).(string)
+	return parent, span
+}
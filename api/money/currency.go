@@ -0,0 +1,40 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCurrency is used for transactions and spenders that do not name one.
+const DefaultCurrency = "THB"
+
+// iso4217 lists the active ISO 4217 alphabetic currency codes.
+var iso4217 = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND
+		BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF
+		DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD
+		HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW
+		KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR
+		MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN
+		PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN
+		SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES
+		VND VUV WST XAF XCD XOF XPF YER ZAR ZMW ZWL`) {
+		iso4217[code] = true
+	}
+}
+
+// NormalizeCurrency upper-cases code and checks it against ISO 4217. An empty
+// code resolves to DefaultCurrency.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if !iso4217[code] {
+		return "", fmt.Errorf("invalid currency %q: must be an ISO 4217 code", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,31 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	t.Run("default empty code", func(t *testing.T) {
+		code, err := NormalizeCurrency("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultCurrency, code)
+	})
+
+	t.Run("upper-case known codes", func(t *testing.T) {
+		code, err := NormalizeCurrency(" jpy ")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "JPY", code)
+	})
+
+	for _, code := range []string{"XYZ", "US", "USDT", "฿"} {
+		t.Run("reject "+code, func(t *testing.T) {
+			_, err := NormalizeCurrency(code)
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is an exact monetary value stored in minor units (satang, cents),
+// matching the DECIMAL(10,2) columns in the database.
+type Amount int64
+
+// Max is the largest amount a DECIMAL(10,2) column can hold.
+const Max Amount = 99999999_99
+
+var (
+	ErrTooPrecise = errors.New("amount must have at most two fractional digits")
+	ErrOverflow   = errors.New("amount is too large")
+)
+
+// Parse reads a plain decimal such as "1000", "-12.5" or "0.05". Exponents
+// and more than two fractional digits are rejected instead of being rounded.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		if strings.TrimRight(frac[2:], "0") != "" {
+			return 0, ErrTooPrecise
+		}
+		frac = frac[:2]
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, ErrOverflow
+	}
+	if neg {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+func (a Amount) String() string {
+	n := int64(a)
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// Float64 is meant for ratios and reporting only, never for arithmetic on
+// amounts.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Scan reads DECIMAL columns, which the postgres driver returns as text.
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	case float64:
+		*a = Amount(math.Round(v * 100))
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value writes the amount as a decimal string so postgres never sees a float.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,108 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := map[string]Amount{
+		"0":           0,
+		"1000":        1000_00,
+		"1000.5":      1000_50,
+		"0.05":        5,
+		".5":          50,
+		"-12.34":      -12_34,
+		"100.00":      100_00,
+		"1.500":       1_50,
+		"99999999.99": Max,
+	}
+	for in, want := range valid {
+		t.Run("parse "+in, func(t *testing.T) {
+			got, err := Parse(in)
+
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	invalid := []string{"", "-", "abc", "1e3", "1.2.3", "10.001", "0.125", "99999999999999999999"}
+	for _, in := range invalid {
+		t.Run("reject "+in, func(t *testing.T) {
+			_, err := Parse(in)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "0.00", Amount(0).String())
+	assert.Equal(t, "1000.50", Amount(1000_50).String())
+	assert.Equal(t, "-0.05", Amount(-5).String())
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("marshal as a number with two decimals", func(t *testing.T) {
+		b, err := json.Marshal(struct {
+			Amount Amount `json:"amount"`
+		}{Amount: 1234_50})
+
+		assert.NoError(t, err)
+		assert.Equal(t, `{"amount":1234.50}`, string(b))
+	})
+
+	t.Run("unmarshal numbers and numeric strings exactly", func(t *testing.T) {
+		var v struct {
+			A Amount `json:"a"`
+			B Amount `json:"b"`
+		}
+		err := json.Unmarshal([]byte(`{"a": 0.1, "b": "0.2"}`), &v)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Amount(30), v.A+v.B)
+	})
+
+	t.Run("reject more than two fractional digits", func(t *testing.T) {
+		var a Amount
+		err := json.Unmarshal([]byte(`10.005`), &a)
+
+		assert.ErrorIs(t, err, ErrTooPrecise)
+	})
+}
+
+func TestScan(t *testing.T) {
+	cases := map[string]struct {
+		src  any
+		want Amount
+	}{
+		"postgres numeric text": {[]byte("150.25"), 150_25},
+		"string":                {"7.10", 7_10},
+		"integer":               {int64(300), 300_00},
+		"float":                 {0.1 + 0.2, 30},
+		"null":                  {nil, 0},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var a Amount
+			err := a.Scan(tc.src)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, a)
+		})
+	}
+
+	t.Run("reject unsupported types", func(t *testing.T) {
+		var a Amount
+		assert.Error(t, a.Scan(true))
+	})
+}
+
+func TestValue(t *testing.T) {
+	v, err := Amount(99_90).Value()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "99.90", v)
+}
@@ -0,0 +1,59 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEApplicationMergePatchJSON = "application/merge-patch+json"
+
+// Bind reads the JSON Merge Patch (RFC 7396) in the body of c's request.
+// Plain JSON is accepted too, other content types are unsupported.
+func Bind(c echo.Context) (map[string]json.RawMessage, error) {
+	ct := c.Request().Header.Get(echo.HeaderContentType)
+	if !strings.HasPrefix(ct, MIMEApplicationMergePatchJSON) && !strings.HasPrefix(ct, echo.MIMEApplicationJSON) {
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+MIMEApplicationMergePatchJSON)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, problem.BadRequest(err)
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, problem.BadRequest(err)
+	}
+	return members, nil
+}
+
+// Merge overlays members on fields, pointers to the patchable fields by
+// member name. Members set to null are reset to their zero value, the id
+// member is ignored and any other member is unknown.
+func Merge(fields map[string]any, members map[string]json.RawMessage) error {
+	for name, raw := range members {
+		field, ok := fields[name]
+		if !ok {
+			if name == "id" {
+				continue
+			}
+			return fmt.Errorf("unknown field %q", name)
+		}
+
+		if string(raw) == "null" {
+			reflect.ValueOf(field).Elem().SetZero()
+			continue
+		}
+		if err := json.Unmarshal(raw, field); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package patch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func bind(contentType, body string) (map[string]json.RawMessage, error) {
+	req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	return Bind(echo.New().NewContext(req, httptest.NewRecorder()))
+}
+
+func TestBind(t *testing.T) {
+	t.Run("read a merge patch", func(t *testing.T) {
+		members, err := bind(MIMEApplicationMergePatchJSON, `{"name": "Hong"}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]json.RawMessage{"name": json.RawMessage(`"Hong"`)}, members)
+	})
+
+	t.Run("accept plain JSON", func(t *testing.T) {
+		_, err := bind(echo.MIMEApplicationJSON, `{}`)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("reject other content types", func(t *testing.T) {
+		_, err := bind(echo.MIMETextPlain, `{}`)
+
+		var herr *echo.HTTPError
+		assert.ErrorAs(t, err, &herr)
+		assert.Equal(t, http.StatusUnsupportedMediaType, herr.Code)
+	})
+
+	t.Run("reject a malformed body", func(t *testing.T) {
+		_, err := bind(MIMEApplicationMergePatchJSON, `{ bad`)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+}
+
+func TestMerge(t *testing.T) {
+	type thing struct {
+		Name  string
+		Count int
+	}
+	fields := func(th *thing) map[string]any {
+		return map[string]any{"name": &th.Name, "count": &th.Count}
+	}
+
+	t.Run("overlay the members and reset nulls", func(t *testing.T) {
+		th := thing{Name: "a", Count: 2}
+
+		err := Merge(fields(&th), map[string]json.RawMessage{"id": json.RawMessage(`9`), "name": json.RawMessage(`"b"`), "count": json.RawMessage(`null`)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, thing{Name: "b"}, th)
+	})
+
+	t.Run("reject unknown members", func(t *testing.T) {
+		th := thing{}
+
+		err := Merge(fields(&th), map[string]json.RawMessage{"password": json.RawMessage(`"x"`)})
+
+		assert.ErrorContains(t, err, `unknown field "password"`)
+	})
+
+	t.Run("reject members of the wrong type", func(t *testing.T) {
+		th := thing{}
+
+		err := Merge(fields(&th), map[string]json.RawMessage{"count": json.RawMessage(`"two"`)})
+
+		assert.ErrorContains(t, err, "invalid count")
+	})
+}
@@ -0,0 +1,178 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem types, relative URIs identifying each kind of domain error.
+const (
+	TypeBadRequest    = "/problems/bad-request"
+	TypeValidation    = "/problems/validation"
+	TypeNotFound      = "/problems/not-found"
+	TypeConflict      = "/problems/conflict"
+	TypeDuplicate     = "/problems/duplicate"
+	TypeUnauthorized  = "/problems/unauthorized"
+	TypeForbidden     = "/problems/forbidden"
+	TypeUnprocessable = "/problems/unprocessable"
+	TypeTooLarge      = "/problems/too-large"
+	TypeInternal      = "/problems/internal"
+)
+
+// Problem is the RFC 7807 body written for every failed request.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	SpanID   string `json:"span_id,omitempty"`
+	Errors   any    `json:"errors,omitempty"`
+	Existing any    `json:"existing,omitempty"`
+}
+
+// Error is a domain error handlers return instead of writing a response.
+// Detail is shown to clients, the wrapped Err is only logged.
+type Error struct {
+	Type     string
+	Status   int
+	Detail   string
+	Errors   any
+	Existing any
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Detail, e.Err)
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// BadRequest shows err to the client. Bind errors only show their message,
+// their internal error names the Go types the body was bound to.
+func BadRequest(err error) *Error {
+	detail := err.Error()
+	var herr *echo.HTTPError
+	if errors.As(err, &herr) {
+		detail = fmt.Sprint(herr.Message)
+	}
+	return &Error{Type: TypeBadRequest, Status: http.StatusBadRequest, Detail: detail, Err: err}
+}
+
+func NotFound(detail string) *Error {
+	return &Error{Type: TypeNotFound, Status: http.StatusNotFound, Detail: detail}
+}
+
+func Conflict(detail string) *Error {
+	return &Error{Type: TypeConflict, Status: http.StatusConflict, Detail: detail}
+}
+
+// Duplicate is a conflict with a resource that was already recorded, which
+// is returned to the client so a retry can carry on with it.
+func Duplicate(detail string, existing any) *Error {
+	return &Error{Type: TypeDuplicate, Status: http.StatusConflict, Detail: detail, Existing: existing}
+}
+
+func Unauthorized(detail string) *Error {
+	return &Error{Type: TypeUnauthorized, Status: http.StatusUnauthorized, Detail: detail}
+}
+
+func Forbidden(detail string) *Error {
+	return &Error{Type: TypeForbidden, Status: http.StatusForbidden, Detail: detail}
+}
+
+func Unprocessable(err error) *Error {
+	return &Error{Type: TypeUnprocessable, Status: http.StatusUnprocessableEntity, Detail: err.Error(), Err: err}
+}
+
+func TooLarge(detail string) *Error {
+	return &Error{Type: TypeTooLarge, Status: http.StatusRequestEntityTooLarge, Detail: detail}
+}
+
+// From classifies any error returned by a handler. Unknown errors, such as
+// those coming from the database, become a generic internal error so their
+// text never reaches the client.
+func From(err error) *Error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr
+	}
+
+	var verr *validate.Error
+	if errors.As(err, &verr) {
+		return &Error{Type: TypeValidation, Status: http.StatusBadRequest, Detail: verr.Message, Errors: verr.Errors, Err: err}
+	}
+
+	var herr *echo.HTTPError
+	if errors.As(err, &herr) {
+		typ := "about:blank"
+		if herr.Code == http.StatusBadRequest {
+			typ = TypeBadRequest
+		}
+		return &Error{Type: typ, Status: herr.Code, Detail: fmt.Sprint(herr.Message), Err: err}
+	}
+
+	return &Error{Type: TypeInternal, Status: http.StatusInternalServerError, Detail: "an unexpected error occurred", Err: err}
+}
+
+// Status reports the HTTP status err is rendered with.
+func Status(err error) int {
+	return From(err).Status
+}
+
+// ErrorHandler is the echo.HTTPErrorHandler rendering errors as
+// application/problem+json.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	perr := From(err)
+	logger := mlog.L(c)
+	if perr.Status >= http.StatusInternalServerError {
+		logger.Error("request failed", zap.Error(err))
+	} else {
+		logger.Info("request rejected", zap.Int("status", perr.Status), zap.Error(err))
+	}
+
+	parent, span := mlog.IDs(c)
+	p := Problem{
+		Type:     perr.Type,
+		Title:    http.StatusText(perr.Status),
+		Status:   perr.Status,
+		Detail:   perr.Detail,
+		Instance: c.Request().URL.Path,
+		ParentID: parent,
+		SpanID:   span,
+		Errors:   perr.Errors,
+		Existing: perr.Existing,
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(perr.Status)
+	} else {
+		var b []byte
+		b, err = json.Marshal(p)
+		if err == nil {
+			err = c.Blob(perr.Status, MIMEApplicationProblemJSON, b)
+		}
+	}
+	if err != nil {
+		logger.Error("write problem response", zap.Error(err))
+	}
+}
@@ -0,0 +1,132 @@
+package problem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func serve(t *testing.T, handler echo.HandlerFunc) (*httptest.ResponseRecorder, Problem) {
+	e := echo.New()
+	defer e.Close()
+	e.HTTPErrorHandler = ErrorHandler
+	e.Use(mlog.Middleware(zap.NewNop()))
+	e.GET("/transactions/:id", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/transactions/1", nil)
+	req.Header.Set("X-Parent-ID", "parent-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var p Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return rec, p
+}
+
+func TestErrorHandler(t *testing.T) {
+	t.Run("render domain error as problem json", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			return NotFound("transaction not found")
+		})
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, TypeNotFound, p.Type)
+		assert.Equal(t, "Not Found", p.Title)
+		assert.Equal(t, http.StatusNotFound, p.Status)
+		assert.Equal(t, "transaction not found", p.Detail)
+		assert.Equal(t, "/transactions/1", p.Instance)
+		assert.Equal(t, "parent-1", p.ParentID)
+		assert.NotEmpty(t, p.SpanID)
+	})
+
+	t.Run("render validation error with field errors", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			return &validate.Error{Message: "validation failed", Errors: []validate.FieldError{
+				{Field: "date", Rule: "required", Message: "date is required"},
+			}}
+		})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, TypeValidation, p.Type)
+		assert.Equal(t, "validation failed", p.Detail)
+		assert.Equal(t, []any{map[string]any{"field": "date", "rule": "required", "message": "date is required"}}, p.Errors)
+	})
+
+	t.Run("render duplicate with the existing resource", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			return Duplicate("transaction already recorded", map[string]int{"id": 7})
+		})
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, TypeDuplicate, p.Type)
+		assert.Equal(t, map[string]any{"id": float64(7)}, p.Existing)
+	})
+
+	t.Run("render echo error with its status", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be application/json")
+		})
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Equal(t, "about:blank", p.Type)
+		assert.Equal(t, "content type must be application/json", p.Detail)
+	})
+
+	t.Run("hide the internal error of a bind failure", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			var body struct {
+				Amount int `json:"amount"`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount": "ten"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			return BadRequest((&echo.DefaultBinder{}).BindBody(c.Echo().NewContext(req, httptest.NewRecorder()), &body))
+		})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, TypeBadRequest, p.Type)
+		assert.NotContains(t, p.Detail, "internal=")
+		assert.NotContains(t, p.Detail, "Go struct")
+	})
+
+	t.Run("hide internal error details", func(t *testing.T) {
+		rec, p := serve(t, func(c echo.Context) error {
+			return fmt.Errorf("query: %w", sql.ErrConnDone)
+		})
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, TypeInternal, p.Type)
+		assert.NotContains(t, rec.Body.String(), "sql")
+		assert.Equal(t, "parent-1", p.ParentID)
+	})
+}
+
+func TestStatus(t *testing.T) {
+	cases := map[error]int{
+		BadRequest(errors.New("bad")):                  http.StatusBadRequest,
+		NotFound("missing"):                            http.StatusNotFound,
+		Conflict("exists"):                             http.StatusConflict,
+		Unauthorized("who"):                            http.StatusUnauthorized,
+		Forbidden("denied"):                            http.StatusForbidden,
+		Unprocessable(errors.New("stale")):             http.StatusUnprocessableEntity,
+		TooLarge("big"):                                http.StatusRequestEntityTooLarge,
+		fmt.Errorf("wrapped: %w", NotFound("missing")): http.StatusNotFound,
+		&validate.Error{}:                              http.StatusBadRequest,
+		echo.ErrMethodNotAllowed:                       http.StatusMethodNotAllowed,
+		sql.ErrConnDone:                                http.StatusInternalServerError,
+	}
+	for err, want := range cases {
+		assert.Equal(t, want, Status(err), err.Error())
+	}
+}
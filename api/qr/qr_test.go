@@ -0,0 +1,120 @@
+package qr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// slip is a slip verification payload of bank 014, reference 2024051212345.
+const slip = "003400060000010103014021320240512123455102TH91043C1E"
+
+func withCRC(payload string) string {
+	return fmt.Sprintf("%s%04X", payload, crc16([]byte(payload)))
+}
+
+// fakeReader finds fixed payloads in any image.
+type fakeReader []string
+
+func (f fakeReader) Read(_ context.Context, _ string, r io.Reader) ([]string, error) {
+	io.Copy(io.Discard, r)
+	return f, nil
+}
+
+func TestCRC16(t *testing.T) {
+	// the CRC-16/CCITT-FALSE check value
+	assert.Equal(t, uint16(0x29B1), crc16([]byte("123456789")))
+}
+
+func TestParse(t *testing.T) {
+	fs, err := Parse("000201" + "5303764" + "5802TH")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Field{{"00", "01"}, {"53", "764"}, {"58", "TH"}}, fs)
+
+	v, ok := Lookup(fs, "53")
+	assert.True(t, ok)
+	assert.Equal(t, "764", v)
+
+	for _, payload := range []string{"000", "0005ab", "00xx01"} {
+		_, err := Parse(payload)
+
+		assert.Error(t, err, payload)
+	}
+}
+
+func TestCheckCRC(t *testing.T) {
+	assert.NoError(t, CheckCRC(slip))
+	assert.NoError(t, CheckCRC(slip[:len(slip)-4]+"3c1e"))
+	assert.ErrorIs(t, CheckCRC(strings.Replace(slip, "0103014", "0103004", 1)), ErrCRC)
+	assert.ErrorIs(t, CheckCRC("0002015802TH"), ErrCRC)
+	assert.ErrorIs(t, CheckCRC("00"), ErrCRC)
+}
+
+func TestDecodeSlip(t *testing.T) {
+	s, err := DecodeSlip(slip)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Slip{Bank: "014", Reference: "2024051212345", Country: "TH"}, s)
+
+	t.Run("reject a promptpay payment code", func(t *testing.T) {
+		promptpay := withCRC("000201010211" + "5802TH" + "5303764" + "6304")
+		assert.NoError(t, CheckCRC(promptpay))
+
+		_, err := DecodeSlip(promptpay)
+
+		assert.ErrorIs(t, err, ErrNotSlip)
+	})
+
+	t.Run("reject a slip without reference", func(t *testing.T) {
+		_, err := DecodeSlip(withCRC("00170006000001010301451" + "02TH" + "9104"))
+
+		assert.ErrorIs(t, err, ErrNotSlip)
+	})
+}
+
+func TestReadSlip(t *testing.T) {
+	s, err := ReadSlip(context.Background(), fakeReader{"https://example.com", slip}, "image/png", strings.NewReader("png"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2024051212345", s.Reference)
+
+	_, err = ReadSlip(context.Background(), fakeReader{}, "image/png", strings.NewReader("png"))
+
+	assert.ErrorIs(t, err, ErrNotSlip)
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(config.Extract{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	path := filepath.Join(t.TempDir(), "zbarimg")
+	_, err = New(config.Extract{QR: "zbar", ZBarPath: path})
+	assert.ErrorContains(t, err, "needs the")
+
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755))
+	r, err = New(config.Extract{QR: "zbar", ZBarPath: path})
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+
+	_, err = New(config.Extract{QR: "vision"})
+	assert.Error(t, err)
+}
+
+func TestZBar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zbarimg")
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\nprintf 'first code\\nsecond\\n'\n"), 0o755))
+
+	codes, err := NewZBar(path).Read(context.Background(), "image/png", strings.NewReader("png"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first code", "second"}, codes)
+}
@@ -0,0 +1,92 @@
+package qr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+// Reader finds the payloads of the QR codes in an image.
+type Reader interface {
+	Read(ctx context.Context, contentType string, r io.Reader) ([]string, error)
+}
+
+// New returns the reader selected by cfg.QR, nil when QR decoding is
+// disabled. It fails when the reader's command is not installed.
+func New(cfg config.Extract) (Reader, error) {
+	switch cfg.QR {
+	case "":
+		return nil, nil
+	case "zbar":
+		// the container image does not ship zbarimg, fail early rather
+		// than on every slip
+		path, err := exec.LookPath(cfg.ZBarPath)
+		if err != nil {
+			return nil, fmt.Errorf("qr reader zbar needs the %s command: %w", cfg.ZBarPath, err)
+		}
+		return NewZBar(path), nil
+	default:
+		return nil, fmt.Errorf("unsupported qr reader %q, must be empty or zbar", cfg.QR)
+	}
+}
+
+// ZBar runs the zbarimg command line scanner on image slips.
+type ZBar struct {
+	path string
+}
+
+func NewZBar(path string) *ZBar {
+	return &ZBar{path: path}
+}
+
+// zbarNoCode is the exit status of zbarimg for an image without codes.
+const zbarNoCode = 4
+
+func (z *ZBar) Read(ctx context.Context, contentType string, r io.Reader) ([]string, error) {
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, nil
+	}
+
+	// zbarimg only reads files
+	f, err := os.CreateTemp("", "slip-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, z.path, "--quiet", "--raw", "-Sdisable", "-Sqrcode.enable", f.Name())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == zbarNoCode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zbarimg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// --raw prints one payload per line, payloads may contain spaces
+	var codes []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			codes = append(codes, line)
+		}
+	}
+	return codes, nil
+}
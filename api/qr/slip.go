@@ -0,0 +1,71 @@
+package qr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNotSlip = errors.New("not a slip verification payload")
+
+// slipAPI is the API ID of the Bank of Thailand slip verification payload.
+const slipAPI = "000001"
+
+// Slip is what a bank transfer slip QR code identifies: the sending bank by
+// its three digit Bank of Thailand code and the bank's transaction
+// reference. Together they identify a transfer.
+type Slip struct {
+	Bank      string `json:"bank"`
+	Reference string `json:"reference"`
+	Country   string `json:"country"`
+}
+
+// DecodeSlip reads a slip verification payload: a template in tag 00 with
+// the API ID (00), sending bank (01) and transaction reference (02), the
+// country in tag 51 and the CRC in tag 91.
+func DecodeSlip(payload string) (Slip, error) {
+	if err := CheckCRC(payload); err != nil {
+		return Slip{}, err
+	}
+	fs, err := Parse(payload)
+	if err != nil {
+		return Slip{}, err
+	}
+
+	tmpl, ok := Lookup(fs, "00")
+	if !ok {
+		return Slip{}, fmt.Errorf("%w: missing tag 00", ErrNotSlip)
+	}
+	inner, err := Parse(tmpl)
+	if err != nil {
+		return Slip{}, fmt.Errorf("%w: %w", ErrNotSlip, err)
+	}
+	if api, _ := Lookup(inner, "00"); api != slipAPI {
+		return Slip{}, fmt.Errorf("%w: api id %q", ErrNotSlip, api)
+	}
+
+	var s Slip
+	s.Bank, _ = Lookup(inner, "01")
+	s.Reference, _ = Lookup(inner, "02")
+	s.Country, _ = Lookup(fs, "51")
+	if s.Bank == "" || s.Reference == "" {
+		return Slip{}, fmt.Errorf("%w: missing bank or reference", ErrNotSlip)
+	}
+	return s, nil
+}
+
+// ReadSlip decodes the first slip verification QR code of an image. It
+// returns ErrNotSlip when the image has none.
+func ReadSlip(ctx context.Context, reader Reader, contentType string, r io.Reader) (Slip, error) {
+	payloads, err := reader.Read(ctx, contentType, r)
+	if err != nil {
+		return Slip{}, err
+	}
+	for _, p := range payloads {
+		if s, err := DecodeSlip(p); err == nil {
+			return s, nil
+		}
+	}
+	return Slip{}, ErrNotSlip
+}
@@ -0,0 +1,95 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrCRC = errors.New("payload crc mismatch")
+
+// Field is one tag-length-value entry of an EMVCo payload.
+type Field struct {
+	Tag   string
+	Value string
+}
+
+// Parse splits an EMVCo payload into its fields. Every field is a two digit
+// tag, a two digit length and the value; values of template fields are
+// payloads themselves and can be parsed again.
+func Parse(payload string) ([]Field, error) {
+	var fs []Field
+	for i := 0; i < len(payload); {
+		if i+4 > len(payload) {
+			return nil, fmt.Errorf("truncated field at offset %d", i)
+		}
+		tag := payload[i : i+2]
+		n, err := strconv.Atoi(payload[i+2 : i+4])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid length of tag %s at offset %d", tag, i)
+		}
+		i += 4
+		if i+n > len(payload) {
+			return nil, fmt.Errorf("value of tag %s overruns payload", tag)
+		}
+		fs = append(fs, Field{Tag: tag, Value: payload[i : i+n]})
+		i += n
+	}
+	return fs, nil
+}
+
+// Lookup returns the value of the first field with tag.
+func Lookup(fs []Field, tag string) (string, bool) {
+	for _, f := range fs {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// crcTags are the tags a payload ends its CRC with: 63 in EMVCo merchant
+// QR codes such as PromptPay, 91 in Thai slip verification QR codes.
+var crcTags = []string{"63", "91"}
+
+// CheckCRC verifies the CRC-16/CCITT-FALSE field a payload ends with. The
+// checksum covers everything before its value, its own tag and length
+// included.
+func CheckCRC(payload string) error {
+	if len(payload) < 8 {
+		return fmt.Errorf("%w: payload too short", ErrCRC)
+	}
+	head, sum := payload[:len(payload)-4], payload[len(payload)-4:]
+	tag := head[len(head)-4:]
+	known := false
+	for _, t := range crcTags {
+		known = known || tag == t+"04"
+	}
+	if !known {
+		return fmt.Errorf("%w: payload does not end with a crc field", ErrCRC)
+	}
+
+	want := fmt.Sprintf("%04X", crc16([]byte(head)))
+	if !strings.EqualFold(sum, want) {
+		return fmt.Errorf("%w: got %s, want %s", ErrCRC, sum, want)
+	}
+	return nil
+}
+
+// crc16 computes CRC-16/CCITT-FALSE: polynomial 0x1021, initial value
+// 0xFFFF, no reflection.
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"go.uber.org/zap"
+)
+
+// ErrPermanent, wrapped by a handler error, dead-letters the job at once
+// since retrying cannot help.
+var ErrPermanent = errors.New("permanent failure")
+
+// errNoHandler dead-letters a job at once, retrying cannot help.
+var errNoHandler = errors.New("no handler for job kind")
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+// Job is a unit of background work claimed by one worker at a time.
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int
+	MaxAttempts int
+}
+
+// Final reports whether a failure of this attempt dead-letters the job.
+func (j Job) Final() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler runs a job, an error retries it unless it wraps ErrPermanent.
+type Handler func(ctx context.Context, job Job) error
+
+// Execer is a *sql.DB or *sql.Tx, so jobs can be enqueued in the same
+// transaction as the rows they work on.
+type Execer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Queue is a job queue stored in postgres. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so any number of them, in any number of
+// processes, never run the same job twice at once.
+type Queue struct {
+	db       *sql.DB
+	cfg      config.Queue
+	logger   *zap.Logger
+	handlers map[string]Handler
+}
+
+func New(db *sql.DB, cfg config.Queue, logger *zap.Logger) *Queue {
+	return &Queue{db: db, cfg: cfg, logger: logger, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler of a kind of job, before Run is called.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.handlers[kind] = h
+}
+
+const (
+	cStmt = `INSERT INTO job (kind, payload, max_attempts) VALUES ($1, $2, $3) RETURNING id;`
+
+	// claimStmt takes the next due job, or a running one whose worker let
+	// its lease of $1 milliseconds expire.
+	claimStmt = `UPDATE job SET status = 'running', attempts = attempts + 1, locked_until = now() + $1 * interval '1 millisecond', updated_at = now()
+	WHERE id = (SELECT id FROM job WHERE status = 'queued' AND run_at <= now() OR status = 'running' AND locked_until < now() ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED)
+	RETURNING id, kind, payload, attempts, max_attempts;`
+	doneStmt  = `UPDATE job SET status = 'done', locked_until = NULL, last_error = '', updated_at = now() WHERE id = $1;`
+	retryStmt = `UPDATE job SET status = 'queued', locked_until = NULL, run_at = now() + $2 * interval '1 millisecond', last_error = $3, updated_at = now() WHERE id = $1;`
+	deadStmt  = `UPDATE job SET status = 'dead', locked_until = NULL, last_error = $2, updated_at = now() WHERE id = $1;`
+)
+
+// Enqueue adds a job of kind with payload encoded as JSON.
+func (q *Queue) Enqueue(ctx context.Context, ex Execer, kind string, payload any) (int64, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = ex.QueryRowContext(ctx, cStmt, kind, string(b), q.cfg.MaxAttempts).Scan(&id)
+	return id, err
+}
+
+// Run starts cfg.Workers workers and blocks until ctx is cancelled and every
+// running job has finished.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		ok, err := q.Next(ctx)
+		if err != nil && ctx.Err() == nil {
+			q.logger.Error("process job", zap.Error(err))
+		}
+		if ok {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// Next claims and runs one job, it reports false when none was due.
+func (q *Queue) Next(ctx context.Context) (bool, error) {
+	var j Job
+	var payload []byte
+	err := q.db.QueryRowContext(ctx, claimStmt, q.cfg.Lease.Milliseconds()).Scan(&j.ID, &j.Kind, &payload, &j.Attempts, &j.MaxAttempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	j.Payload = payload
+
+	// a job started before shutdown may finish within its lease
+	jctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.cfg.Lease)
+	defer cancel()
+	return true, q.finish(jctx, j, q.run(jctx, j))
+}
+
+func (q *Queue) run(ctx context.Context, j Job) (err error) {
+	h, ok := q.handlers[j.Kind]
+	if !ok {
+		return fmt.Errorf("%w %q", errNoHandler, j.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h(ctx, j)
+}
+
+func (q *Queue) finish(ctx context.Context, j Job, err error) error {
+	logger := q.logger.With(zap.Int64("job_id", j.ID), zap.String("kind", j.Kind), zap.Int("attempt", j.Attempts))
+	if err == nil {
+		logger.Info("job done")
+		_, err := q.db.ExecContext(ctx, doneStmt, j.ID)
+		return err
+	}
+
+	if j.Final() || errors.Is(err, errNoHandler) || errors.Is(err, ErrPermanent) {
+		logger.Error("job dead-lettered", zap.Error(err))
+		_, err := q.db.ExecContext(ctx, deadStmt, j.ID, err.Error())
+		return err
+	}
+
+	delay := q.Backoff(j.Attempts)
+	logger.Warn("job failed, retrying", zap.Duration("delay", delay), zap.Error(err))
+	_, err = q.db.ExecContext(ctx, retryStmt, j.ID, delay.Milliseconds(), err.Error())
+	return err
+}
+
+// Backoff is the delay before retrying a job that failed its attempt: Backoff
+// doubled for every earlier attempt, up to MaxBackoff.
+func (q *Queue) Backoff(attempt int) time.Duration {
+	d := q.cfg.Backoff
+	for i := 1; i < attempt && d < q.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.cfg.MaxBackoff {
+		d = q.cfg.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var cfg = config.Queue{Workers: 1, PollInterval: time.Millisecond, MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second, Lease: time.Minute}
+
+var columns = []string{"id", "kind", "payload", "attempts", "max_attempts"}
+
+func newQueue(t *testing.T) (*Queue, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return New(db, cfg, zap.NewNop()), mock
+}
+
+func TestEnqueue(t *testing.T) {
+	q, mock := newQueue(t)
+	mock.ExpectQuery(cStmt).WithArgs("upload.process", `{"upload_id":7}`, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	id, err := q.Enqueue(context.Background(), q.db, "upload.process", map[string]int{"upload_id": 7})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNext(t *testing.T) {
+	t.Run("report an empty queue", func(t *testing.T) {
+		q, mock := newQueue(t)
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).WillReturnRows(sqlmock.NewRows(columns))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("mark a finished job done", func(t *testing.T) {
+		q, mock := newQueue(t)
+		var got Job
+		q.Handle("echo", func(_ context.Context, j Job) error {
+			got = j
+			return nil
+		})
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "echo", []byte(`{"a":1}`), 1, 3))
+		mock.ExpectExec(doneStmt).WithArgs(int64(4)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, Job{ID: 4, Kind: "echo", Payload: []byte(`{"a":1}`), Attempts: 1, MaxAttempts: 3}, got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retry a failed job after a backoff", func(t *testing.T) {
+		q, mock := newQueue(t)
+		q.Handle("echo", func(context.Context, Job) error { return errors.New("boom") })
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "echo", []byte(`{}`), 2, 3))
+		mock.ExpectExec(retryStmt).WithArgs(int64(4), int64(2000), "boom").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dead-letter a job failing its last attempt", func(t *testing.T) {
+		q, mock := newQueue(t)
+		q.Handle("echo", func(context.Context, Job) error { panic("boom") })
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "echo", []byte(`{}`), 3, 3))
+		mock.ExpectExec(deadStmt).WithArgs(int64(4), "job panicked: boom").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dead-letter a job failing permanently", func(t *testing.T) {
+		q, mock := newQueue(t)
+		q.Handle("echo", func(context.Context, Job) error { return fmt.Errorf("%w: gone", ErrPermanent) })
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "echo", []byte(`{}`), 1, 3))
+		mock.ExpectExec(deadStmt).WithArgs(int64(4), "permanent failure: gone").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dead-letter a job of an unknown kind", func(t *testing.T) {
+		q, mock := newQueue(t)
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "mystery", []byte(`{}`), 1, 3))
+		mock.ExpectExec(deadStmt).WithArgs(int64(4), `no handler for job kind "mystery"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ok, err := q.Next(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRun(t *testing.T) {
+	q, mock := newQueue(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 10; i++ {
+		mock.ExpectQuery(claimStmt).WithArgs(int64(60000)).WillReturnRows(sqlmock.NewRows(columns))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers did not stop")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := New(nil, cfg, zap.NewNop())
+
+	assert.Equal(t, time.Second, q.Backoff(1))
+	assert.Equal(t, 2*time.Second, q.Backoff(2))
+	assert.Equal(t, 4*time.Second, q.Backoff(3))
+	assert.Equal(t, 5*time.Second, q.Backoff(4))
+	assert.Equal(t, 5*time.Second, q.Backoff(40))
+}
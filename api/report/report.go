@@ -0,0 +1,128 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// ErrMissingRate is returned when a transaction cannot be converted to the
+// base currency because no exchange rate was effective on its date.
+var ErrMissingRate = errors.New("missing exchange rate")
+
+// Range limits a report to the transactions dated between From and To,
+// either end is open when nil.
+type Range struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// Summary totals one transaction type. AveragePerDay spreads Total over the
+// days of the range, from the first to the last transaction when the range
+// is open.
+type Summary struct {
+	Currency      string       `json:"currency"`
+	TotalAmount   money.Amount `json:"total_amount"`
+	AveragePerDay money.Amount `json:"average_per_day"`
+	Count         int          `json:"count"`
+}
+
+// Balance is what a spender earned, spent and saved.
+type Balance struct {
+	Currency       string       `json:"currency"`
+	TotalIncome    money.Amount `json:"total_income"`
+	TotalExpenses  money.Amount `json:"total_expenses"`
+	CurrentBalance money.Amount `json:"current_balance"`
+}
+
+// Service computes the reports of a spender's transactions in their base
+// currency.
+type Service struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Service {
+	return &Service{db}
+}
+
+const bStmt = `SELECT base_currency FROM spender WHERE id = $1`
+
+// convertedStmt lists the transactions of %[1]s, aliased t, with their
+// amount in the base currency %[2]s, see Converted.
+const convertedStmt = `SELECT t.date, t.category, t.transaction_type,
+		CASE WHEN t.currency = %[2]s THEN t.amount ELSE ROUND(t.amount * r.rate, 2) END AS amount,
+		t.currency <> %[2]s AND r.rate IS NULL AS missing
+	FROM %[1]s t
+	LEFT JOIN LATERAL (SELECT rate FROM exchange_rate WHERE from_currency = t.currency AND to_currency = %[2]s AND effective_date <= t.date::date ORDER BY effective_date DESC LIMIT 1) r ON true`
+
+// Converted returns a query listing the transactions of from, a table or a
+// parenthesized subquery, with their amount in the base currency given by
+// the placeholder base, converted with the latest rate effective on each
+// transaction's date. missing marks transactions that have no such rate.
+// Conditions on the transactions may follow as a WHERE clause on t.
+func Converted(from, base string) string {
+	return fmt.Sprintf(convertedStmt, from, base)
+}
+
+var (
+	// converted lists the transactions of spender $1 within $3 and $4
+	// converted to the base currency $2.
+	converted = Converted("transaction", "$2") + `
+	WHERE t.spender_id = $1 AND ($3::timestamptz IS NULL OR t.date >= $3) AND ($4::timestamptz IS NULL OR t.date <= $4)`
+
+	summaryStmt = `WITH c AS (` + converted + ` AND t.transaction_type = $5)
+	SELECT COALESCE(SUM(amount), 0),
+		COALESCE(ROUND(SUM(amount) / (COALESCE($4::timestamptz, MAX(date))::date - COALESCE($3::timestamptz, MIN(date))::date + 1), 2), 0),
+		COUNT(*),
+		COUNT(*) FILTER (WHERE missing)
+	FROM c`
+
+	balanceStmt = `WITH c AS (` + converted + `)
+	SELECT COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+		COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0),
+		COUNT(*) FILTER (WHERE missing)
+	FROM c`
+)
+
+// BaseCurrency returns the base currency of spender, or sql.ErrNoRows when
+// there is no such spender.
+func (s *Service) BaseCurrency(ctx context.Context, spender int64) (string, error) {
+	var base string
+	err := s.db.QueryRowContext(ctx, bStmt, spender).Scan(&base)
+	return base, err
+}
+
+// Summary totals the tType transactions of spender within r.
+func (s *Service) Summary(ctx context.Context, spender int64, tType, base string, r Range) (Summary, error) {
+	sum := Summary{Currency: base}
+	var missing int
+	err := s.db.QueryRowContext(ctx, summaryStmt, spender, base, r.From, r.To, tType).
+		Scan(&sum.TotalAmount, &sum.AveragePerDay, &sum.Count, &missing)
+	if err != nil {
+		return Summary{}, err
+	}
+	if missing > 0 {
+		return Summary{}, fmt.Errorf("%w to %s for %d %s transactions", ErrMissingRate, base, missing, tType)
+	}
+	return sum, nil
+}
+
+// Balance totals the income and expenses of spender within r.
+func (s *Service) Balance(ctx context.Context, spender int64, base string, r Range) (Balance, error) {
+	b := Balance{Currency: base}
+	var missing int
+	err := s.db.QueryRowContext(ctx, balanceStmt, spender, base, r.From, r.To).
+		Scan(&b.TotalIncome, &b.TotalExpenses, &missing)
+	if err != nil {
+		return Balance{}, err
+	}
+	if missing > 0 {
+		return Balance{}, fmt.Errorf("%w to %s for %d transactions", ErrMissingRate, base, missing)
+	}
+	b.CurrentBalance = b.TotalIncome - b.TotalExpenses
+	return b, nil
+}
@@ -0,0 +1,71 @@
+//go:build integration
+
+package report
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/migration"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// The seed migration records 12 income of 2755.00 and 14 expenses of
+// 1870.00 for spender 1, all on 2024-05-12.
+
+func TestSummaryIT(t *testing.T) {
+	t.Run("summarise expenses of the seeded day", func(t *testing.T) {
+		db, err := getTestDatabaseFromConfig()
+		if err != nil {
+			t.Error(err)
+		}
+		migration.ApplyMigrations(db)
+		defer migration.RollbackMigrations(db)
+
+		got, err := New(db).Summary(context.Background(), 1, "expense", "THB", Range{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Currency: "THB", TotalAmount: 1870_00, AveragePerDay: 1870_00, Count: 14}, got)
+	})
+
+	t.Run("spread income over the days of the range", func(t *testing.T) {
+		db, err := getTestDatabaseFromConfig()
+		if err != nil {
+			t.Error(err)
+		}
+		migration.ApplyMigrations(db)
+		defer migration.RollbackMigrations(db)
+		from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2024, 5, 31, 23, 59, 59, 0, time.UTC)
+
+		got, err := New(db).Summary(context.Background(), 1, "income", "THB", Range{From: &from, To: &to})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Currency: "THB", TotalAmount: 2755_00, AveragePerDay: 88_87, Count: 12}, got)
+	})
+}
+
+func TestBalanceIT(t *testing.T) {
+	t.Run("balance the seeded transactions", func(t *testing.T) {
+		db, err := getTestDatabaseFromConfig()
+		if err != nil {
+			t.Error(err)
+		}
+		migration.ApplyMigrations(db)
+		defer migration.RollbackMigrations(db)
+
+		got, err := New(db).Balance(context.Background(), 1, "THB", Range{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Balance{Currency: "THB", TotalIncome: 2755_00, TotalExpenses: 1870_00, CurrentBalance: 885_00}, got)
+	})
+}
+
+func getTestDatabaseFromConfig() (*sql.DB, error) {
+	cfg := config.Parse("DOCKER")
+	return sql.Open("postgres", cfg.PostgresURI())
+}
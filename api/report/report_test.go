@@ -0,0 +1,111 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newService(t *testing.T) (*Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return New(db), mock
+}
+
+func TestBaseCurrency(t *testing.T) {
+	t.Run("return the spender's base currency", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(bStmt).WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+
+		got, err := s.BaseCurrency(context.Background(), 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "USD", got)
+	})
+
+	t.Run("report a missing spender", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(bStmt).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"base_currency"}))
+
+		_, err := s.BaseCurrency(context.Background(), 9)
+
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestSummary(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 31, 23, 59, 59, 0, time.UTC)
+	columns := []string{"total", "average", "count", "missing"}
+
+	t.Run("total the expenses within the range", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(summaryStmt).WithArgs(int64(1), "THB", &from, &to, "expense").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("1550.00", "50.00", 12, 0))
+
+		got, err := s.Summary(context.Background(), 1, "expense", "THB", Range{From: &from, To: &to})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Currency: "THB", TotalAmount: 1550_00, AveragePerDay: 50_00, Count: 12}, got)
+	})
+
+	t.Run("total all the income when the range is open", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(summaryStmt).WithArgs(int64(1), "THB", nil, nil, "income").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("0", "0", 0, 0))
+
+		got, err := s.Summary(context.Background(), 1, "income", "THB", Range{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Currency: "THB"}, got)
+	})
+
+	t.Run("fail when an exchange rate is missing", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(summaryStmt).WithArgs(int64(1), "THB", nil, nil, "expense").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("100.00", "100.00", 2, 1))
+
+		_, err := s.Summary(context.Background(), 1, "expense", "THB", Range{})
+
+		assert.ErrorIs(t, err, ErrMissingRate)
+	})
+}
+
+func TestBalance(t *testing.T) {
+	columns := []string{"income", "expense", "missing"}
+
+	t.Run("subtract expenses from income", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(balanceStmt).WithArgs(int64(1), "THB", nil, nil).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("3200.00", "2150.50", 0))
+
+		got, err := s.Balance(context.Background(), 1, "THB", Range{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Balance{Currency: "THB", TotalIncome: 3200_00, TotalExpenses: 2150_50, CurrentBalance: 1049_50}, got)
+	})
+
+	t.Run("fail when an exchange rate is missing", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(balanceStmt).WithArgs(int64(1), "THB", nil, nil).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("0", "0", 3))
+
+		_, err := s.Balance(context.Background(), 1, "THB", Range{})
+
+		assert.ErrorIs(t, err, ErrMissingRate)
+	})
+
+	t.Run("fail on database", func(t *testing.T) {
+		s, mock := newService(t)
+		mock.ExpectQuery(balanceStmt).WithArgs(int64(1), "THB", nil, nil).WillReturnError(assert.AnError)
+
+		_, err := s.Balance(context.Background(), 1, "THB", Range{})
+
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -1,25 +1,70 @@
 package spender
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/patch"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/report"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/transactions"
 	"github.com/kkgo-software-engineering/workshop/mlog"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
 type Spender struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID           int64  `json:"id"`
+	Name         string `json:"name" validate:"required,max=255"`
+	Email        string `json:"email" validate:"required,email,max=255"`
+	BaseCurrency string `json:"base_currency" validate:"currency"`
+	// Password is only accepted on create, a spender without one cannot
+	// sign in. bcrypt hashes at most 72 bytes.
+	Password string `json:"password,omitempty" validate:"omitempty,min=8,maxbytes=72"`
+}
+
+// Delete policies, see config.FeatureFlag.
+const (
+	DeleteReject  = "reject"
+	DeleteCascade = "cascade"
+	DeleteArchive = "archive"
+)
+
+// ValidDeletePolicy reports whether p is one of the delete policies.
+func ValidDeletePolicy(p string) bool {
+	return p == DeleteReject || p == DeleteCascade || p == DeleteArchive
 }
 
 type SpenderSummary struct {
-	Summary transactions.Summary `json:"summary"`
+	Currency string               `json:"currency"`
+	Summary  transactions.Summary `json:"summary"`
+}
+
+// DefaultTimezone is the timezone periods start in when the request names
+// none.
+const DefaultTimezone = "Asia/Bangkok"
+
+type SpenderPeriods struct {
+	Currency string `json:"currency"`
+	Interval string `json:"interval"`
+	Timezone string `json:"timezone"`
+	transactions.Periods
+}
+
+type SpenderCategories struct {
+	Currency   string                         `json:"currency"`
+	Categories []transactions.CategorySummary `json:"categories"`
 }
 
 type handler struct {
@@ -32,12 +77,36 @@ func New(cfg config.FeatureFlag, db *sql.DB) *handler {
 }
 
 const (
-	cStmt = `INSERT INTO spender (name, email) VALUES ($1, $2) RETURNING id;`
+	cStmt = `INSERT INTO spender (name, email, base_currency, password_hash) VALUES ($1, $2, $3, $4) RETURNING id;`
+	lStmt = `SELECT id, name, email, base_currency FROM spender WHERE archived_at IS NULL ORDER BY id`
+	eStmt = `SELECT id, name, email, base_currency FROM spender WHERE lower(email) = $1 AND archived_at IS NULL`
+	gStmt = `SELECT id, name, email, base_currency FROM spender WHERE id = $1 AND archived_at IS NULL`
+	uStmt = `UPDATE spender SET name = $2, email = $3, base_currency = $4 WHERE id = $1 AND archived_at IS NULL;`
+	aStmt = `UPDATE spender SET archived_at = now() WHERE id = $1 AND archived_at IS NULL;`
+	dStmt = `DELETE FROM spender WHERE id = $1;`
+	// the spender's pending uploads and drafts go with them whatever the
+	// policy, stored slips are left in the blob store
+	dUploadStmt      = `DELETE FROM upload WHERE spender_id = $1;`
+	dDraftStmt       = `DELETE FROM draft WHERE spender_id = $1;`
+	dTransactionStmt = `DELETE FROM "transaction" WHERE spender_id = $1;`
 )
 
+// Postgres error codes, and the index keeping emails unique.
+const (
+	errForeignKey = "23503"
+	errUnique     = "23505"
+	emailIndex    = "spender_email_idx"
+)
+
+// existing is the spender already registered with an email, see
+// problem.Duplicate.
+type existing struct {
+	ID int64 `json:"id"`
+}
+
 func (h handler) Create(c echo.Context) error {
 	if !h.flag.EnableCreateSpender {
-		return c.JSON(http.StatusForbidden, "create new spender feature is disabled")
+		return problem.Forbidden("create new spender feature is disabled")
 	}
 
 	logger := mlog.L(c)
@@ -45,40 +114,53 @@ func (h handler) Create(c echo.Context) error {
 	var sp Spender
 	err := c.Bind(&sp)
 	if err != nil {
-		logger.Error("bad request body", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return problem.BadRequest(err)
+	}
+	normalize(&sp)
+	if err := c.Validate(sp); err != nil {
+		return err
+	}
+
+	var hash sql.NullString
+	if sp.Password != "" {
+		if hash.String, err = auth.HashPassword(sp.Password); err != nil {
+			return err
+		}
+		hash.Valid = true
 	}
 
 	var lastInsertId int64
-	err = h.db.QueryRowContext(ctx, cStmt, sp.Name, sp.Email).Scan(&lastInsertId)
+	err = h.db.QueryRowContext(ctx, cStmt, sp.Name, sp.Email, sp.BaseCurrency, hash).Scan(&lastInsertId)
 	if err != nil {
-		logger.Error("query row error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return h.conflict(ctx, sp.Email, err)
 	}
 
 	logger.Info("create successfully", zap.Int64("id", lastInsertId))
 	sp.ID = lastInsertId
+	sp.Password = ""
 	return c.JSON(http.StatusCreated, sp)
 }
 
+// GetAll lists the spenders that are not archived, only the one registered
+// with the email query parameter when it is given.
 func (h handler) GetAll(c echo.Context) error {
-	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT id, name, email FROM spender`)
+	query, args := lStmt, []any{}
+	if email := c.QueryParam("email"); email != "" {
+		query, args = eStmt, []any{normalizeEmail(email)}
+	}
+	rows, err := h.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	defer rows.Close()
 
-	var sps []Spender
+	sps := []Spender{}
 	for rows.Next() {
 		var sp Spender
-		err := rows.Scan(&sp.ID, &sp.Name, &sp.Email)
-		if err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
+		if err := scanSpender(rows, &sp); err != nil {
+			return err
 		}
 		sps = append(sps, sp)
 	}
@@ -86,108 +168,394 @@ func (h handler) GetAll(c echo.Context) error {
 	return c.JSON(http.StatusOK, sps)
 }
 
-func (h handler) SpenderTransactionById(c echo.Context) error {
+func (h handler) GetByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	var sp Spender
+	err = scanSpender(h.db.QueryRowContext(c.Request().Context(), gStmt, id), &sp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("spender not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, sp)
+}
+
+// Update replaces the name, email and base currency of a spender, the
+// password cannot be changed here.
+func (h handler) Update(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	var sp Spender
+	if err := c.Bind(&sp); err != nil {
+		return problem.BadRequest(err)
+	}
+	sp.ID = id
+	sp.Password = ""
+	normalize(&sp)
+	if err := c.Validate(sp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	result, err := h.db.ExecContext(ctx, uStmt, id, sp.Name, sp.Email, sp.BaseCurrency)
+	if err != nil {
+		return h.conflict(ctx, sp.Email, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return problem.NotFound("spender not found")
+	}
+
+	return c.JSON(http.StatusOK, sp)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to a spender, like
+// transactions Patch does to a transaction.
+func (h handler) Patch(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	members, err := patch.Bind(c)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sp Spender
+	err = scanSpender(tx.QueryRowContext(ctx, gStmt+" FOR UPDATE", id), &sp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("spender not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := mergePatch(&sp, members); err != nil {
+		return problem.BadRequest(err)
+	}
+	normalize(&sp)
+	if err := c.Validate(sp); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, uStmt, id, sp.Name, sp.Email, sp.BaseCurrency); err != nil {
+		return h.conflict(ctx, sp.Email, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, sp)
+}
+
+// Delete removes a spender following the SpenderDeletePolicy flag: reject
+// answers 409 while the spender has transactions, cascade deletes them too
+// and archive keeps everything but hides the spender and stops their sign
+// in.
+func (h handler) Delete(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
-	id := c.Param("id")
-	page := c.QueryParam("page")
-	limit := c.QueryParam("limit")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
 
-	if page == "" {
-		page = "1"
+	var rows int64
+	switch h.flag.SpenderDeletePolicy {
+	case DeleteArchive:
+		rows, err = h.archive(ctx, id)
+	case DeleteCascade, DeleteReject:
+		rows, err = h.delete(ctx, id, h.flag.SpenderDeletePolicy == DeleteCascade)
+	default:
+		return fmt.Errorf("unknown spender delete policy %q", h.flag.SpenderDeletePolicy)
 	}
-	if limit == "" {
-		limit = "10"
+	var perr *pq.Error
+	if errors.As(err, &perr) && perr.Code == errForeignKey {
+		return problem.Conflict("spender still has transactions")
 	}
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return problem.NotFound("spender not found")
+	}
+
+	logger.Info("delete successfully", zap.Int64("id", id), zap.String("policy", h.flag.SpenderDeletePolicy))
+	return c.NoContent(http.StatusNoContent)
+}
 
-	rows, err := h.db.QueryContext(ctx, `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id
-	FROM transaction
-	WHERE spender_id = $1
-	LIMIT $2
-	OFFSET $3`, id, limit, page)
+// conflict turns a write rejected for reusing an email into a 409 carrying
+// the id of the spender holding it, other errors are returned as they are.
+func (h handler) conflict(ctx context.Context, email string, err error) error {
+	var perr *pq.Error
+	if !errors.As(err, &perr) || perr.Code != errUnique || perr.Constraint != emailIndex {
+		return err
+	}
+
+	var sp Spender
+	if err := scanSpender(h.db.QueryRowContext(ctx, eStmt, email), &sp); err != nil {
+		return err
+	}
+	return problem.Duplicate("email is already registered", existing{ID: sp.ID})
+}
+
+func (h handler) archive(ctx context.Context, id int64) (int64, error) {
+	result, err := h.db.ExecContext(ctx, aStmt, id)
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return 0, err
 	}
+	return result.RowsAffected()
+}
 
-	var ts []transactions.Transaction
-	for rows.Next() {
-		var t transactions.Transaction
-		err = rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageUrl, &t.SpenderID)
-		if err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
-		ts = append(ts, t)
+// delete removes the spender with their uploads and drafts, and with their
+// transactions when cascade is set. Otherwise the foreign key from
+// transaction rejects the delete.
+func (h handler) delete(ctx context.Context, id int64, cascade bool) (int64, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	exp := 0.0
-	inc := 0.0
-	for _, v := range ts {
-		if v.TransactionType == "expense" {
-			exp += v.Amount
-		} else if v.TransactionType == "income" {
-			inc += v.Amount
+	stmts := []string{dUploadStmt, dDraftStmt}
+	if cascade {
+		stmts = append(stmts, dTransactionStmt)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			return 0, err
 		}
 	}
 
-	sum := transactions.Summary{
-		TotalExpenses:  exp,
-		TotalIncome:    inc,
-		CurrentBalance: inc - exp,
+	result, err := tx.ExecContext(ctx, dStmt, id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
+	return rows, tx.Commit()
+}
 
-	reCP, err := strconv.Atoi(page)
+func (h handler) SpenderTransactionById(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		logger.Error("scan error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.BadRequest(err)
 	}
-	reL, err := strconv.Atoi(limit)
+
+	f, err := transactions.ParseFilter(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	f.SpenderID = &id
+
+	s, err := transactions.ParseSort(c)
 	if err != nil {
-		logger.Error("scan error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.BadRequest(err)
 	}
-	pg := transactions.Pagination{
-		CurrentPage: reCP,
-		TotalPage:   0,
-		PerPage:     reL,
+	p, err := transactions.ParsePage(c)
+	if err != nil {
+		return problem.BadRequest(err)
 	}
 
-	ss := transactions.T{
-		Transections: ts,
-		Summary:      sum,
-		Pagination:   pg,
+	hs := transactions.New(h.flag, h.db)
+	ss, err := hs.List(ctx, f, s, p)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, ss)
 }
 
+// SpenderTransactionByIdSummary totals a spender's income and expenses in
+// their base currency, within the from and to query parameters.
 func (h handler) SpenderTransactionByIdSummary(c echo.Context) error {
-	logger := mlog.L(c)
-	id, err := strconv.Atoi(c.Param("id"))
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.BadRequest(err)
 	}
 
-	hs := transactions.New(h.flag, h.db)
-	income, err := hs.GetSummary(id, "income")
+	r, err := transactions.ParseRange(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	reports := report.New(h.db)
+	base, err := reports.BaseCurrency(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("spender not found")
+	}
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
+	}
+
+	b, err := reports.Balance(ctx, id, base, r)
+	if errors.Is(err, report.ErrMissingRate) {
+		return problem.Unprocessable(err)
 	}
-	expense, err := hs.GetSummary(id, "expense")
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	ss := SpenderSummary{
+		Currency: base,
 		Summary: transactions.Summary{
-			TotalIncome:    income,
-			TotalExpenses:  expense,
-			CurrentBalance: income - expense,
+			TotalIncome:    b.TotalIncome,
+			TotalExpenses:  b.TotalExpenses,
+			CurrentBalance: b.CurrentBalance,
 		},
 	}
 
 	return c.JSON(http.StatusOK, ss)
 }
+
+// SpenderTransactionByIdCategories breaks a spender's transactions down by
+// category in their base currency. It takes the transaction filters, such
+// as from and to.
+func (h handler) SpenderTransactionByIdCategories(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	f, err := transactions.ParseFilter(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	f.SpenderID = &id
+
+	base, err := report.New(h.db).BaseCurrency(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("spender not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	hs := transactions.New(h.flag, h.db)
+	categories, err := hs.CategorySummary(ctx, f, base)
+	if errors.Is(err, transactions.ErrMissingRate) {
+		return problem.Unprocessable(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, SpenderCategories{Currency: base, Categories: categories})
+}
+
+// SpenderTransactionByIdPeriods totals a spender's transactions per day,
+// week, month or year, the interval query parameter, in their base currency.
+// Periods start at midnight in the timezone query parameter, where bare from
+// and to dates are read too, and periods without transactions are reported
+// with zero totals.
+func (h handler) SpenderTransactionByIdPeriods(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = transactions.IntervalDay
+	}
+	if !transactions.ValidInterval(interval) {
+		return problem.BadRequest(fmt.Errorf("invalid interval %q: must be day, week, month or year", interval))
+	}
+	tz := c.QueryParam("timezone")
+	if tz == "" {
+		tz = DefaultTimezone
+	}
+	// Local is the server's timezone, which the database does not know
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return problem.BadRequest(fmt.Errorf("invalid timezone %q", tz))
+	}
+
+	f, err := transactions.ParseFilterIn(c, loc)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	f.SpenderID = &id
+
+	base, err := report.New(h.db).BaseCurrency(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("spender not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	hs := transactions.New(h.flag, h.db)
+	periods, err := hs.PeriodSummary(ctx, f, base, interval, loc)
+	if errors.Is(err, transactions.ErrMissingRate) {
+		return problem.Unprocessable(err)
+	}
+	if errors.Is(err, transactions.ErrTooManyPeriods) {
+		return problem.BadRequest(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, SpenderPeriods{Currency: base, Interval: interval, Timezone: loc.String(), Periods: periods})
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSpender(row scanner, sp *Spender) error {
+	return row.Scan(&sp.ID, &sp.Name, &sp.Email, &sp.BaseCurrency)
+}
+
+// normalize canonicalises the email and base currency ahead of validation,
+// an omitted currency means money.DefaultCurrency.
+func normalize(sp *Spender) {
+	sp.Email = normalizeEmail(sp.Email)
+	sp.BaseCurrency = strings.ToUpper(strings.TrimSpace(sp.BaseCurrency))
+	if sp.BaseCurrency == "" {
+		sp.BaseCurrency = money.DefaultCurrency
+	}
+}
+
+// mergePatch overlays members on sp, see patch.Merge. The password cannot
+// be patched.
+func mergePatch(sp *Spender, members map[string]json.RawMessage) error {
+	fields := map[string]any{
+		"name":          &sp.Name,
+		"email":         &sp.Email,
+		"base_currency": &sp.BaseCurrency,
+	}
+	return patch.Merge(fields, members)
+}
+
+// normalizeEmail lowercases email, emails are unique whatever their case.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
 	"github.com/KKGo-Software-engineering/workshop-summer/migration"
 	"github.com/labstack/echo/v4"
 	_ "github.com/lib/pq"
@@ -27,6 +28,7 @@ func TestCreateSpenderIT(t *testing.T) {
 
 		h := New(config.FeatureFlag{EnableCreateSpender: true}, sql)
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		e.POST("/spenders", h.Create)
@@ -54,6 +56,7 @@ func TestGetAllSpenderIT(t *testing.T) {
 
 		h := New(config.FeatureFlag{}, sql)
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		e.GET("/spenders", h.GetAll)
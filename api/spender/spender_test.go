@@ -1,6 +1,8 @@
 package spender
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -9,14 +11,29 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transactions"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// passwordHash captures the hashed password argument of an insert.
+type passwordHash struct{ hash *string }
+
+func (p passwordHash) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*p.hash = s
+	return ok
+}
+
 func TestCreateSpender(t *testing.T) {
 
 	t.Run("create spender succesfully when feature toggle is enable", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok"}`))
@@ -28,7 +45,7 @@ func TestCreateSpender(t *testing.T) {
 		defer db.Close()
 
 		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnRows(row)
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "THB", nil).WillReturnRows(row)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -36,11 +53,38 @@ func TestCreateSpender(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, rec.Code)
-		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok"}`, rec.Body.String())
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "base_currency": "THB"}`, rec.Body.String())
+	})
+
+	t.Run("create spender with a hashed password", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "s3cret-pass"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		var hash string
+		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "THB", passwordHash{&hash}).WillReturnRows(row)
+
+		h := New(config.FeatureFlag{EnableCreateSpender: true}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "password")
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret-pass")))
 	})
 
 	t.Run("create spender failed when feature toggle is disable", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok"}`))
@@ -53,12 +97,12 @@ func TestCreateSpender(t *testing.T) {
 		h := New(cfg, nil)
 		err := h.Create(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, http.StatusForbidden, problem.Status(err))
 	})
 
 	t.Run("create spender failed when bad request body", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{ bad request body }`))
@@ -70,13 +114,13 @@ func TestCreateSpender(t *testing.T) {
 		h := New(cfg, nil)
 		err := h.Create(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Contains(t, rec.Body.String(), "invalid character")
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid character")
 	})
 
 	t.Run("create spender failed on database (feature toggle is enable) ", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok"}`))
@@ -87,20 +131,76 @@ func TestCreateSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnError(assert.AnError)
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "THB", nil).WillReturnError(assert.AnError)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
 		err := h.Create(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+
+	t.Run("create spender failed when email is registered", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": " Hong@Jot.OK "}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", "THB", nil).
+			WillReturnError(&pq.Error{Code: errUnique, Constraint: emailIndex})
+		mock.ExpectQuery(eStmt).WithArgs("hong@jot.ok").WillReturnRows(spenderRow())
+		cfg := config.FeatureFlag{EnableCreateSpender: true}
+
+		h := New(cfg, db)
+		err := h.Create(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+		var perr *problem.Error
+		assert.ErrorAs(t, err, &perr)
+		assert.Equal(t, existing{ID: 1}, perr.Existing)
 	})
 }
 
+func TestCreateSpenderValidation(t *testing.T) {
+	bodies := map[string]string{
+		"email is malformed":    `{"name": "HongJot", "email": "hong-at-jot"}`,
+		"name is missing":       `{"email": "hong@jot.ok"}`,
+		"currency is not ISO":   `{"name": "HongJot", "email": "hong@jot.ok", "base_currency": "BAHT"}`,
+		"email is missing":      `{"name": "HongJot"}`,
+		"password is too short": `{"name": "HongJot", "email": "hong@jot.ok", "password": "short"}`,
+		"password is too long":  `{"name": "HongJot", "email": "hong@jot.ok", "password": "` + strings.Repeat("ก", 30) + `"}`,
+	}
+	for name, body := range bodies {
+		t.Run("create spender failed when "+name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = validate.New()
+			defer e.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := New(config.FeatureFlag{EnableCreateSpender: true}, nil)
+			err := h.Create(c)
+
+			assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+			assert.ErrorContains(t, err, "validation failed")
+		})
+	}
+}
+
 func TestGetAllSpender(t *testing.T) {
 	t.Run("get all spender succesfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -110,22 +210,23 @@ func TestGetAllSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "email"}).
-			AddRow(1, "HongJot", "hong@jot.ok").
-			AddRow(2, "JotHong", "jot@jot.ok")
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "name", "email", "base_currency"}).
+			AddRow(1, "HongJot", "hong@jot.ok", "THB").
+			AddRow(2, "JotHong", "jot@jot.ok", "USD")
+		mock.ExpectQuery(lStmt).WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `[{"id": 1, "name": "HongJot", "email": "hong@jot.ok"},
-		{"id": 2, "name": "JotHong", "email": "jot@jot.ok"}]`, rec.Body.String())
+		assert.JSONEq(t, `[{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "base_currency": "THB"},
+		{"id": 2, "name": "JotHong", "email": "jot@jot.ok", "base_currency": "USD"}]`, rec.Body.String())
 	})
 
 	t.Run("get all spender failed on database", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -135,19 +236,62 @@ func TestGetAllSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnError(assert.AnError)
+		mock.ExpectQuery(lStmt).WillReturnError(assert.AnError)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetAll(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+
+	t.Run("look spender up by email", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/?email=Hong@Jot.ok", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(eStmt).WithArgs("hong@jot.ok").WillReturnRows(spenderRow())
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
 
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "base_currency": "THB"}]`, rec.Body.String())
+	})
+
+	t.Run("look up an unknown email", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/?email=nobody@jot.ok", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(eStmt).WithArgs("nobody@jot.ok").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "base_currency"}))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetAll(c)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[]`, rec.Body.String())
 	})
 }
 
 func TestSpenderTransactionById(t *testing.T) {
 	t.Run("get spender succesfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions", nil)
@@ -160,16 +304,15 @@ func TestSpenderTransactionById(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 		dt := time.Date(2024, 05, 11, 0, 0, 0, 0, time.UTC)
-		rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-			AddRow(1, dt, 100, "category", "expense", "notes", "url_to_image2", 1).
-			AddRow(2, dt, 200, "category", "expense", "notes", "url_to_image2", 1)
-
-		mock.ExpectQuery(`SELECT id, date, amount, category, transaction_type, note, image_url, spender_id
-		FROM transaction
-		WHERE spender_id = $1
-		LIMIT $2
-		OFFSET $3`).
-			WithArgs("1", "10", "1").
+		rows := sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 100, "THB", "category", "expense", "notes", "url_to_image2", 1, "").
+			AddRow(2, dt, 200, "THB", "category", "expense", "notes", "url_to_image2", 1, "")
+
+		mock.ExpectQuery(`SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction WHERE spender_id = $1 GROUP BY currency ORDER BY currency`).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 2, 0, 300))
+		mock.ExpectQuery(`SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction WHERE spender_id = $1 ORDER BY date DESC, id DESC LIMIT $2 OFFSET $3`).
+			WithArgs(int64(1), 10, 0).
 			WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
@@ -183,6 +326,7 @@ func TestSpenderTransactionById(t *testing.T) {
 				"id": 1,
 				"date": "2024-05-11T00:00:00Z",
 				"amount": 100,
+				"currency": "THB",
 				"category": "category",
 				"transaction_type": "expense",
 				"note": "notes",
@@ -193,6 +337,7 @@ func TestSpenderTransactionById(t *testing.T) {
 				"id": 2,
 				"date": "2024-05-11T00:00:00Z",
 				"amount": 200,
+				"currency": "THB",
 				"category": "category",
 				"transaction_type": "expense",
 				"note": "notes",
@@ -200,24 +345,88 @@ func TestSpenderTransactionById(t *testing.T) {
 				"spender_id": 1
 			  }
 			],
-			"summary": {
+			"summary": [{
+			  "currency": "THB",
 			  "total_income": 0,
 			  "total_expenses": 300,
 			  "current_balance": -300
-			},
+			}],
 			"pagination": {
 			  "current_page": 1,
-			  "total_pages": 0,
+			  "total_pages": 1,
 			  "per_page": 10
 			}
 		  }`, rec.Body.String())
 	})
+
+	t.Run("get spender transactions on a later page", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions?page=3&limit=5", nil)
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction WHERE spender_id = $1 GROUP BY currency ORDER BY currency`).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 26, 2000, 1500))
+		mock.ExpectQuery(`SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction WHERE spender_id = $1 ORDER BY date DESC, id DESC LIMIT $2 OFFSET $3`).
+			WithArgs(int64(1), 5, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.SpenderTransactionById(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"transections": [],
+			"summary": [{
+			  "currency": "THB",
+			  "total_income": 2000,
+			  "total_expenses": 1500,
+			  "current_balance": 500
+			}],
+			"pagination": {
+			  "current_page": 3,
+			  "total_pages": 6,
+			  "per_page": 5
+			}
+		  }`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get spender transactions failed when page is malformed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions?page=zero", nil)
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.SpenderTransactionById(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
 }
 
 func TestSpenderTransactionByIdSummary(t *testing.T) {
 
 	t.Run("get spender summary succesfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions/summary", nil)
@@ -230,17 +439,12 @@ func TestSpenderTransactionByIdSummary(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		inRow := sqlmock.NewRows([]string{"sum"}).
-			AddRow(300)
-		exRow := sqlmock.NewRows([]string{"sum"}).
-			AddRow(300)
-
-		mock.ExpectQuery(`SELECT SUM(amount) FROM transaction WHERE spender_id = $1 AND transaction_type = $2`).
-			WithArgs(1, "income").
-			WillReturnRows(inRow)
-		mock.ExpectQuery(`SELECT SUM(amount) FROM transaction WHERE spender_id = $1 AND transaction_type = $2`).
-			WithArgs(1, "expense").
-			WillReturnRows(exRow)
+		mock.ExpectQuery(`SELECT base_currency FROM spender WHERE id = $1`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("THB"))
+		mock.ExpectQuery(balanceStmt).
+			WithArgs(1, "THB", nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expense", "missing"}).AddRow(300, 300, 0))
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.SpenderTransactionByIdSummary(c)
@@ -248,6 +452,7 @@ func TestSpenderTransactionByIdSummary(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.JSONEq(t, `{
+			"currency": "THB",
 			"summary": {
 			  "total_income": 300,
 			  "total_expenses": 300,
@@ -255,4 +460,380 @@ func TestSpenderTransactionByIdSummary(t *testing.T) {
 			}
 		  }`, rec.Body.String())
 	})
+
+	t.Run("get spender summary not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/9/transactions/summary", nil)
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("9")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT base_currency FROM spender WHERE id = $1`).
+			WithArgs(9).
+			WillReturnError(sql.ErrNoRows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.SpenderTransactionByIdSummary(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	t.Run("get spender summary failed when an exchange rate is missing", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/spenders/1/transactions/summary", nil)
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT base_currency FROM spender WHERE id = $1`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+		mock.ExpectQuery(balanceStmt).
+			WithArgs(1, "USD", nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expense", "missing"}).AddRow(0, 0, 1))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.SpenderTransactionByIdSummary(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.ErrorContains(t, err, "missing exchange rate")
+	})
+}
+
+const balanceStmt = `WITH c AS (SELECT t.date, t.category, t.transaction_type,
+		CASE WHEN t.currency = $2 THEN t.amount ELSE ROUND(t.amount * r.rate, 2) END AS amount,
+		t.currency <> $2 AND r.rate IS NULL AS missing
+	FROM transaction t
+	LEFT JOIN LATERAL (SELECT rate FROM exchange_rate WHERE from_currency = t.currency AND to_currency = $2 AND effective_date <= t.date::date ORDER BY effective_date DESC LIMIT 1) r ON true
+	WHERE t.spender_id = $1 AND ($3::timestamptz IS NULL OR t.date >= $3) AND ($4::timestamptz IS NULL OR t.date <= $4))
+	SELECT COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+		COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0),
+		COUNT(*) FILTER (WHERE missing)
+	FROM c`
+
+// spenderContext serves a request on the spender with id 1.
+func spenderContext(method, contentType, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validate.New()
+	req := httptest.NewRequest(method, "/spenders/1", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	return c, rec
+}
+
+func spenderRow() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "email", "base_currency"}).AddRow(1, "HongJot", "hong@jot.ok", "THB")
+}
+
+func TestGetSpenderByID(t *testing.T) {
+	t.Run("get spender succesfully", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodGet, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(gStmt).WithArgs(int64(1)).WillReturnRows(spenderRow())
+
+		err := New(config.FeatureFlag{}, db).GetByID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "base_currency": "THB"}`, rec.Body.String())
+	})
+
+	t.Run("get spender not found", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodGet, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(gStmt).WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+
+		err := New(config.FeatureFlag{}, db).GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestUpdateSpender(t *testing.T) {
+	t.Run("update spender succesfully", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodPut, echo.MIMEApplicationJSON, `{"name": "Hong", "email": "hong@jot.ok", "base_currency": "usd"}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(uStmt).WithArgs(int64(1), "Hong", "hong@jot.ok", "USD").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "Hong", "email": "hong@jot.ok", "base_currency": "USD"}`, rec.Body.String())
+	})
+
+	t.Run("update spender failed when validation fails", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodPut, echo.MIMEApplicationJSON, `{"name": "Hong", "email": "not-an-email"}`)
+		db, _, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("update spender not found", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodPut, echo.MIMEApplicationJSON, `{"name": "Hong", "email": "hong@jot.ok"}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(uStmt).WithArgs(int64(1), "Hong", "hong@jot.ok", "THB").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestPatchSpender(t *testing.T) {
+	t.Run("patch spender succesfully", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodPatch, "application/merge-patch+json", `{"name": "Hong", "base_currency": null}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnRows(spenderRow())
+		mock.ExpectExec(uStmt).WithArgs(int64(1), "Hong", "hong@jot.ok", "THB").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "Hong", "email": "hong@jot.ok", "base_currency": "THB"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch spender failed when patching the password", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodPatch, "application/merge-patch+json", `{"password": "secret-password"}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnRows(spenderRow())
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("patch spender not found", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodPatch, "application/merge-patch+json", `{"name": "Hong"}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestDeleteSpender(t *testing.T) {
+	t.Run("reject deleting a spender with transactions", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodDelete, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec(dUploadStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(dDraftStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnError(&pq.Error{Code: errForeignKey})
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{SpenderDeletePolicy: DeleteReject}, db).Delete(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete a spender without transactions", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodDelete, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec(dUploadStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(dDraftStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{SpenderDeletePolicy: DeleteReject}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("cascade the delete to transactions", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodDelete, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec(dUploadStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(dDraftStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(dTransactionStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := New(config.FeatureFlag{SpenderDeletePolicy: DeleteCascade}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("archive the spender", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodDelete, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(aStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(config.FeatureFlag{SpenderDeletePolicy: DeleteArchive}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("delete spender not found", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodDelete, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(aStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := New(config.FeatureFlag{SpenderDeletePolicy: DeleteArchive}, db).Delete(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestSpenderTransactionByIdCategories(t *testing.T) {
+	t.Run("get spender categories succesfully", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodGet, "", "")
+		c.Request().URL.RawQuery = "from=2024-05-01"
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery(`SELECT base_currency FROM spender`).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("THB"))
+		mock.ExpectQuery(`SELECT category,`).WithArgs("THB", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"category", "income", "income_count", "income_percentage", "expense", "expense_count", "expense_percentage", "missing"}).
+				AddRow("Salary", "200.00", 1, "100.00", "0.00", 0, "0", 0))
+
+		err := New(config.FeatureFlag{}, db).SpenderTransactionByIdCategories(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"currency": "THB", "categories": [{
+			"category": "Salary",
+			"income": {"total": 200, "count": 1, "percentage": 100},
+			"expense": {"total": 0, "count": 0, "percentage": 0}
+		}]}`, rec.Body.String())
+	})
+
+	t.Run("get spender categories failed when from is malformed", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodGet, "", "")
+		c.Request().URL.RawQuery = "from=yesterday"
+		db, _, _ := sqlmock.New()
+		defer db.Close()
+
+		err := New(config.FeatureFlag{}, db).SpenderTransactionByIdCategories(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("get spender categories not found", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodGet, "", "")
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(`SELECT base_currency FROM spender WHERE id = $1`).WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+
+		err := New(config.FeatureFlag{}, db).SpenderTransactionByIdCategories(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
+
+func TestSpenderTransactionByIdPeriods(t *testing.T) {
+	t.Run("get spender periods succesfully", func(t *testing.T) {
+		c, rec := spenderContext(http.MethodGet, "", "")
+		c.Request().URL.RawQuery = "interval=month&timezone=Asia/Tokyo&from=2024-05-01"
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		from := time.Date(2024, 5, 1, 0, 0, 0, 0, tokyo)
+		mock.ExpectQuery(`SELECT base_currency FROM spender`).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("THB"))
+		mock.ExpectQuery(`WITH c AS`).WithArgs("THB", "month", "Asia/Tokyo", &from, nil, from, int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"start", "income", "income_count", "income_average", "expense", "expense_count", "expense_average", "average_income", "average_expense", "missing"}).
+				AddRow(from.UTC(), "0", 0, "0", "150.00", 2, "75.00", "0", "150.00", 0))
+
+		err := New(config.FeatureFlag{}, db).SpenderTransactionByIdPeriods(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"currency": "THB", "interval": "month", "timezone": "Asia/Tokyo",
+			"periods": [{
+				"start": "2024-05-01T00:00:00+09:00",
+				"income": {"total": 0, "count": 0, "average": 0},
+				"expense": {"total": 150, "count": 2, "average": 75}
+			}],
+			"average": {"income": 0, "expense": 150}
+		}`, rec.Body.String())
+	})
+
+	t.Run("get spender periods failed when the range spans too many periods", func(t *testing.T) {
+		c, _ := spenderContext(http.MethodGet, "", "")
+		c.Request().URL.RawQuery = "interval=day&timezone=UTC&from=2020-01-01&to=2024-12-31"
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery(`SELECT base_currency FROM spender`).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("THB"))
+		rows := sqlmock.NewRows([]string{"start", "income", "income_count", "income_average", "expense", "expense_count", "expense_average", "average_income", "average_expense", "missing"})
+		for i := 0; i <= transactions.MaxPeriods; i++ {
+			rows.AddRow(time.Date(2020, 1, 1+i, 0, 0, 0, 0, time.UTC), "0", 0, "0", "0", 0, "0", "0", "0", 0)
+		}
+		mock.ExpectQuery(`WITH c AS`).WillReturnRows(rows)
+
+		err := New(config.FeatureFlag{}, db).SpenderTransactionByIdPeriods(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	for name, query := range map[string]string{
+		"interval is unknown": "interval=hour",
+		"timezone is unknown": "timezone=Mars/Olympus",
+		"timezone is local":   "timezone=Local",
+		"from is malformed":   "from=yesterday",
+	} {
+		t.Run("get spender periods failed when "+name, func(t *testing.T) {
+			c, _ := spenderContext(http.MethodGet, "", "")
+			c.Request().URL.RawQuery = query
+			db, _, _ := sqlmock.New()
+			defer db.Close()
+
+			err := New(config.FeatureFlag{}, db).SpenderTransactionByIdPeriods(c)
+
+			assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		})
+	}
 }
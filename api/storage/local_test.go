@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("put, get and delete an object", func(t *testing.T) {
+		store, err := NewLocal(t.TempDir())
+		assert.NoError(t, err)
+
+		loc, err := store.Put(ctx, "slips/a.png", strings.NewReader("png bytes"), 9, "image/png")
+		assert.NoError(t, err)
+		assert.Equal(t, "slips/a.png", loc)
+
+		r, err := store.Get(ctx, "slips/a.png")
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(r)
+		r.Close()
+		assert.Equal(t, "png bytes", string(b))
+
+		assert.NoError(t, store.Delete(ctx, "slips/a.png"))
+		_, err = store.Get(ctx, "slips/a.png")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	for _, key := range []string{"../escape.png", "/etc/passwd", "", "a/../../b"} {
+		t.Run("reject key "+key, func(t *testing.T) {
+			store, _ := NewLocal(t.TempDir())
+
+			_, err := store.Put(ctx, key, strings.NewReader("x"), 1, "")
+
+			assert.ErrorIs(t, err, ErrInvalidKey)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// BlobStore persists uploaded files. Put returns the location the object can
+// be found at, which is its key whatever the backend.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the backend selected by cfg.Backend.
+func New(cfg config.Storage) (BlobStore, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.LocalDir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q, must be local or s3", cfg.Backend)
+	}
+}
@@ -0,0 +1,76 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/report"
+)
+
+// CategoryTotal totals one transaction type of a category. Percentage is
+// its share of that type's total across all categories.
+type CategoryTotal struct {
+	Total      money.Amount `json:"total"`
+	Count      int          `json:"count"`
+	Percentage float64      `json:"percentage"`
+}
+
+type CategorySummary struct {
+	Category string        `json:"category"`
+	Income   CategoryTotal `json:"income"`
+	Expense  CategoryTotal `json:"expense"`
+}
+
+// categoryStmt totals the transactions %s lists, converted to the base
+// currency $1 with report.Converted, per category. The percentages are
+// shares of the grand totals, a window over the groups. The last column
+// counts transactions that have no rate.
+const categoryStmt = `SELECT category,
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0),
+	COUNT(*) FILTER (WHERE transaction_type = 'income'),
+	COALESCE(ROUND(100 * SUM(amount) FILTER (WHERE transaction_type = 'income') / NULLIF(SUM(SUM(amount) FILTER (WHERE transaction_type = 'income')) OVER (), 0), 2), 0),
+	COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0),
+	COUNT(*) FILTER (WHERE transaction_type = 'expense'),
+	COALESCE(ROUND(100 * SUM(amount) FILTER (WHERE transaction_type = 'expense') / NULLIF(SUM(SUM(amount) FILTER (WHERE transaction_type = 'expense')) OVER (), 0), 2), 0),
+	COUNT(*) FILTER (WHERE missing)
+	FROM (%s
+		WHERE t.transaction_type IN ('income', 'expense')) c
+	GROUP BY category
+	ORDER BY category`
+
+// categoryQuery is categoryStmt over the transactions matching where.
+func categoryQuery(where string) string {
+	return fmt.Sprintf(categoryStmt, report.Converted("(SELECT * FROM transaction"+where+")", "$1"))
+}
+
+// CategorySummary breaks the transactions matching f down by category in
+// the base currency. It returns ErrMissingRate when a transaction cannot be
+// converted.
+func (h handler) CategorySummary(ctx context.Context, f Filter, base string) ([]CategorySummary, error) {
+	where, args := f.Where(1)
+	rows, err := h.db.QueryContext(ctx, categoryQuery(where), append([]any{base}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []CategorySummary{}
+	for rows.Next() {
+		var s CategorySummary
+		var missing int
+		err := rows.Scan(&s.Category,
+			&s.Income.Total, &s.Income.Count, &s.Income.Percentage,
+			&s.Expense.Total, &s.Expense.Count, &s.Expense.Percentage,
+			&missing)
+		if err != nil {
+			return nil, err
+		}
+		if missing > 0 {
+			return nil, fmt.Errorf("%w to %s for %d %s transactions", ErrMissingRate, base, missing, s.Category)
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
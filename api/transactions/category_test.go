@@ -0,0 +1,50 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategorySummary(t *testing.T) {
+	columns := []string{"category", "income", "income_count", "income_percentage", "expense", "expense_count", "expense_percentage", "missing"}
+	id := int64(1)
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	f := Filter{From: &from, SpenderID: &id}
+
+	t.Run("total each category", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(categoryQuery(" WHERE date >= $2 AND spender_id = $3")).
+			WithArgs("THB", from, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("Dining", "0.00", 0, "0", "60.00", 2, "25.00", 0).
+				AddRow("Salary", "200.00", 1, "100.00", "0.00", 0, "0", 0).
+				AddRow("Travel", "0.00", 0, "0", "180.00", 1, "75.00", 0))
+
+		got, err := New(config.FeatureFlag{}, db).CategorySummary(context.Background(), f, "THB")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []CategorySummary{
+			{Category: "Dining", Expense: CategoryTotal{Total: 6000, Count: 2, Percentage: 25}},
+			{Category: "Salary", Income: CategoryTotal{Total: 20000, Count: 1, Percentage: 100}},
+			{Category: "Travel", Expense: CategoryTotal{Total: 18000, Count: 1, Percentage: 75}},
+		}, got)
+	})
+
+	t.Run("fail when an exchange rate is missing", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(categoryQuery(" WHERE date >= $2 AND spender_id = $3")).
+			WithArgs("THB", from, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("Travel", "0.00", 0, "0", "180.00", 1, "100.00", 1))
+
+		_, err := New(config.FeatureFlag{}, db).CategorySummary(context.Background(), f, "THB")
+
+		assert.ErrorIs(t, err, ErrMissingRate)
+	})
+}
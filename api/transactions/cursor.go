@@ -0,0 +1,102 @@
+package transactions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Cursor marks a position in the (date, id) ordering used by cursor
+// pagination. Backward cursors page towards newer transactions.
+type Cursor struct {
+	Date     time.Time `json:"d"`
+	ID       int64     `json:"i"`
+	Backward bool      `json:"b,omitempty"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func (cur Cursor) Encode() string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+
+	var cur Cursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID <= 0 {
+		return Cursor{}, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// keyset appends the cursor condition and ordering to a filtered query.
+// Transactions are listed newest first, so paging forward walks towards
+// older rows and rows inserted meanwhile never shift the pages ahead.
+func keyset(where string, args []any, cur *Cursor, limit int) (string, []any) {
+	order := " ORDER BY date DESC, id DESC"
+
+	if cur != nil {
+		op := "<"
+		if cur.Backward {
+			op = ">"
+			order = " ORDER BY date ASC, id ASC"
+		}
+
+		cond := fmt.Sprintf("(date, id) %s ($%d, $%d)", op, len(args)+1, len(args)+2)
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, cur.Date, cur.ID)
+	}
+
+	args = append(args, limit+1)
+	return fmt.Sprintf("%s%s%s LIMIT $%d", lStmt, where, order, len(args)), args
+}
+
+// cursorPage trims the look-ahead row fetched by keyset, restores newest
+// first order for backward pages and computes the surrounding cursors.
+func cursorPage(ts []Transaction, cur *Cursor, limit int) ([]Transaction, Pagination) {
+	more := len(ts) > limit
+	if more {
+		ts = ts[:limit]
+	}
+
+	backward := cur != nil && cur.Backward
+	if backward {
+		for i, j := 0, len(ts)-1; i < j; i, j = i+1, j-1 {
+			ts[i], ts[j] = ts[j], ts[i]
+		}
+	}
+
+	pg := Pagination{PerPage: limit}
+	if len(ts) == 0 {
+		return ts, pg
+	}
+
+	first, last := ts[0], ts[len(ts)-1]
+	next := Cursor{Date: last.Date, ID: last.ID}.Encode()
+	prev := Cursor{Date: first.Date, ID: first.ID, Backward: true}.Encode()
+	if backward {
+		pg.NextCursor = next
+		if more {
+			pg.PrevCursor = prev
+		}
+	} else {
+		if more {
+			pg.NextCursor = next
+		}
+		if cur != nil {
+			pg.PrevCursor = prev
+		}
+	}
+	return ts, pg
+}
@@ -0,0 +1,188 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorEncoding(t *testing.T) {
+	t.Run("decode what was encoded", func(t *testing.T) {
+		cur := Cursor{Date: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC), ID: 42, Backward: true}
+
+		got, err := DecodeCursor(cur.Encode())
+
+		assert.NoError(t, err)
+		assert.Equal(t, cur, got)
+	})
+
+	for _, s := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		t.Run("reject "+s, func(t *testing.T) {
+			_, err := DecodeCursor(s)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParsePageCursorMode(t *testing.T) {
+	t.Run("opt in with mode", func(t *testing.T) {
+		p, err := ParsePage(newFilterContext("mode=cursor&limit=5"))
+
+		assert.NoError(t, err)
+		assert.True(t, p.Keyset)
+		assert.Nil(t, p.Cursor)
+		assert.Equal(t, 5, p.Limit)
+	})
+
+	t.Run("cursor implies cursor mode", func(t *testing.T) {
+		cur := Cursor{Date: time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC), ID: 7}
+
+		p, err := ParsePage(newFilterContext("cursor=" + cur.Encode()))
+
+		assert.NoError(t, err)
+		assert.True(t, p.Keyset)
+		assert.Equal(t, cur, *p.Cursor)
+	})
+
+	for _, query := range []string{"mode=random", "cursor=garbage", "mode=cursor&page=2"} {
+		t.Run("reject "+query, func(t *testing.T) {
+			_, err := ParsePage(newFilterContext(query))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	dt := time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+
+	t.Run("first page only orders and limits", func(t *testing.T) {
+		query, args := keyset("", nil, nil, 10)
+
+		assert.Equal(t, lStmt+" ORDER BY date DESC, id DESC LIMIT $1", query)
+		assert.Equal(t, []any{11}, args)
+	})
+
+	t.Run("forward cursor continues with older rows", func(t *testing.T) {
+		query, args := keyset(" WHERE spender_id = $1", []any{int64(1)}, &Cursor{Date: dt, ID: 3}, 10)
+
+		assert.Equal(t, lStmt+" WHERE spender_id = $1 AND (date, id) < ($2, $3) ORDER BY date DESC, id DESC LIMIT $4", query)
+		assert.Equal(t, []any{int64(1), dt, int64(3), 11}, args)
+	})
+
+	t.Run("backward cursor walks towards newer rows", func(t *testing.T) {
+		query, args := keyset("", nil, &Cursor{Date: dt, ID: 3, Backward: true}, 10)
+
+		assert.Equal(t, lStmt+" WHERE (date, id) > ($1, $2) ORDER BY date ASC, id ASC LIMIT $3", query)
+		assert.Equal(t, []any{dt, int64(3), 11}, args)
+	})
+}
+
+func TestCursorPage(t *testing.T) {
+	dt := time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+	rows := func(ids ...int64) []Transaction {
+		var ts []Transaction
+		for _, id := range ids {
+			ts = append(ts, Transaction{ID: id, Date: dt})
+		}
+		return ts
+	}
+
+	t.Run("first page with more rows has only a next cursor", func(t *testing.T) {
+		ts, pg := cursorPage(rows(5, 4, 3), nil, 2)
+
+		assert.Equal(t, rows(5, 4), ts)
+		assert.Equal(t, Cursor{Date: dt, ID: 4}.Encode(), pg.NextCursor)
+		assert.Empty(t, pg.PrevCursor)
+	})
+
+	t.Run("last forward page has only a prev cursor", func(t *testing.T) {
+		ts, pg := cursorPage(rows(2, 1), &Cursor{Date: dt, ID: 3}, 2)
+
+		assert.Equal(t, rows(2, 1), ts)
+		assert.Empty(t, pg.NextCursor)
+		assert.Equal(t, Cursor{Date: dt, ID: 2, Backward: true}.Encode(), pg.PrevCursor)
+	})
+
+	t.Run("backward page is returned newest first", func(t *testing.T) {
+		ts, pg := cursorPage(rows(3, 4, 5), &Cursor{Date: dt, ID: 2, Backward: true}, 2)
+
+		assert.Equal(t, rows(4, 3), ts)
+		assert.Equal(t, Cursor{Date: dt, ID: 3}.Encode(), pg.NextCursor)
+		assert.Equal(t, Cursor{Date: dt, ID: 4, Backward: true}.Encode(), pg.PrevCursor)
+	})
+
+	t.Run("empty page has no cursors", func(t *testing.T) {
+		ts, pg := cursorPage([]Transaction{}, nil, 2)
+
+		assert.Empty(t, ts)
+		assert.Equal(t, Pagination{PerPage: 2}, pg)
+	})
+}
+
+func TestGetAllTransactionCursorMode(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+	cur := Cursor{Date: dt, ID: 3}
+
+	req := httptest.NewRequest(http.MethodGet, "/transactions?limit=1&cursor="+cur.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	auth.SetIdentity(c, admin)
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	mock.ExpectQuery(sumStmt + sumGroup).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 3, 0, 300))
+	mock.ExpectQuery(lStmt+` WHERE (date, id) < ($1, $2) ORDER BY date DESC, id DESC LIMIT $3`).
+		WithArgs(dt, int64(3), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(2, dt, 100, "THB", "Food", "expense", "", "", 1, "").
+			AddRow(1, dt, 100, "THB", "Food", "expense", "", "", 1, ""))
+
+	h := New(config.FeatureFlag{}, db)
+	err := h.GetAll(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"transections": [
+		  {
+			"id": 2,
+			"date": "2024-05-11T09:07:29Z",
+			"amount": 100,
+			"currency": "THB",
+			"category": "Food",
+			"transaction_type": "expense",
+			"note": "",
+			"image_url": "",
+			"spender_id": 1
+		  }
+		],
+		"summary": [{
+		  "currency": "THB",
+		  "total_income": 0,
+		  "total_expenses": 300,
+		  "current_balance": -300
+		}],
+		"pagination": {
+		  "current_page": 0,
+		  "total_pages": 0,
+		  "per_page": 1,
+		  "next_cursor": "`+Cursor{Date: dt, ID: 2}.Encode()+`",
+		  "prev_cursor": "`+Cursor{Date: dt, ID: 2, Backward: true}.Encode()+`"
+		}
+	}`, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
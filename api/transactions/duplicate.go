@@ -0,0 +1,89 @@
+package transactions
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// Querier is a *sql.DB or *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const (
+	// dupStmt finds a transaction of the same spender, type, currency and
+	// amount paid with the same slip reference or, when either has no
+	// reference, in the same minute. Entries dated without a time of day
+	// fall at midnight UTC, whatever the session timezone, and are never
+	// matched by minute.
+	dupStmt = lStmt + ` WHERE spender_id = $1 AND amount = $2 AND transaction_type = $5 AND currency = $6
+	AND (reference = $4 AND $4 <> '' OR (reference = '' OR $4 = '') AND $3::timestamptz AT TIME ZONE 'UTC' <> date_trunc('day', $3::timestamptz AT TIME ZONE 'UTC')
+	AND date_trunc('minute', date) = date_trunc('minute', $3::timestamptz))
+	ORDER BY id LIMIT 1`
+
+	// reportStmt groups transactions suspected to record the same payment:
+	// by slip reference, by minute of day when references do not tell them
+	// apart, and by the content hash of their attached slips.
+	reportStmt = `SELECT 'reference', spender_id, amount, reference, '', array_agg(id ORDER BY id) FROM transaction
+	WHERE reference <> '' GROUP BY spender_id, transaction_type, currency, amount, reference HAVING COUNT(*) > 1
+	UNION ALL
+	SELECT 'date', spender_id, amount, '', '', array_agg(id ORDER BY id) FROM transaction WHERE date AT TIME ZONE 'UTC' <> date_trunc('day', date AT TIME ZONE 'UTC')
+	GROUP BY spender_id, transaction_type, currency, amount, date_trunc('minute', date) HAVING COUNT(*) > 1 AND COUNT(DISTINCT NULLIF(reference, '')) <= 1
+	UNION ALL
+	SELECT 'slip', t.spender_id, NULL, '', a.sha256, array_agg(DISTINCT t.id ORDER BY t.id) FROM attachment a JOIN transaction t ON t.id = a.transaction_id
+	GROUP BY t.spender_id, a.sha256 HAVING COUNT(DISTINCT t.id) > 1
+	ORDER BY 2, 1`
+)
+
+// FindDuplicate returns the transaction t would record again, or
+// sql.ErrNoRows when there is none.
+func FindDuplicate(ctx context.Context, q Querier, t Transaction) (Transaction, error) {
+	var dup Transaction
+	err := scanTransaction(q.QueryRowContext(ctx, dupStmt, t.SpenderID, t.Amount, t.Date, t.Reference, t.TransactionType, t.Currency), &dup)
+	return dup, err
+}
+
+// Duplicate is the conflict returned instead of recording existing again.
+func Duplicate(existing Transaction) error {
+	return problem.Duplicate("transaction is already recorded", existing)
+}
+
+// Suspect is a group of transactions that look like the same payment.
+type Suspect struct {
+	Reason         string        `json:"reason"`
+	SpenderID      int64         `json:"spender_id"`
+	Amount         *money.Amount `json:"amount,omitempty"`
+	Reference      string        `json:"reference,omitempty"`
+	SHA256         string        `json:"sha256,omitempty"`
+	TransactionIDs []int64       `json:"transaction_ids"`
+}
+
+// Duplicates reports suspected duplicates recorded before they were
+// detected on creation, for admins to review.
+func (h handler) Duplicates(c echo.Context) error {
+	rows, err := h.db.QueryContext(c.Request().Context(), reportStmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ss := []Suspect{}
+	for rows.Next() {
+		var s Suspect
+		if err := rows.Scan(&s.Reason, &s.SpenderID, &s.Amount, &s.Reference, &s.SHA256, pq.Array(&s.TransactionIDs)); err != nil {
+			return err
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ss)
+}
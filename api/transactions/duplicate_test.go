@@ -0,0 +1,69 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicates(t *testing.T) {
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validate.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/transactions/duplicates", nil), rec)
+		auth.SetIdentity(c, admin)
+		return c, rec
+	}
+
+	t.Run("report suspected duplicates", func(t *testing.T) {
+		c, rec := newContext()
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(reportStmt).WillReturnRows(sqlmock.NewRows([]string{"reason", "spender_id", "amount", "reference", "sha256", "ids"}).
+			AddRow("date", 1, "45.00", "", "", "{3,8}").
+			AddRow("reference", 1, "1250.50", "2024051212345", "", "{4,9,12}").
+			AddRow("slip", 2, nil, "", "abc", "{5,6}"))
+
+		err := New(config.FeatureFlag{}, db).Duplicates(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[
+			{"reason": "date", "spender_id": 1, "amount": 45, "transaction_ids": [3, 8]},
+			{"reason": "reference", "spender_id": 1, "amount": 1250.5, "reference": "2024051212345", "transaction_ids": [4, 9, 12]},
+			{"reason": "slip", "spender_id": 2, "sha256": "abc", "transaction_ids": [5, 6]}
+		]`, rec.Body.String())
+	})
+
+	t.Run("report no duplicates as an empty list", func(t *testing.T) {
+		c, rec := newContext()
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(reportStmt).WillReturnRows(sqlmock.NewRows([]string{"reason", "spender_id", "amount", "reference", "sha256", "ids"}))
+
+		err := New(config.FeatureFlag{}, db).Duplicates(c)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[]`, rec.Body.String())
+	})
+
+	t.Run("report failed on database", func(t *testing.T) {
+		c, _ := newContext()
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(reportStmt).WillReturnError(assert.AnError)
+
+		err := New(config.FeatureFlag{}, db).Duplicates(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+}
@@ -0,0 +1,161 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/labstack/echo/v4"
+)
+
+const dateLayout = "2006-01-02"
+
+type Filter struct {
+	From            *time.Time
+	To              *time.Time
+	Amount          *money.Amount
+	MinAmount       *money.Amount
+	MaxAmount       *money.Amount
+	Currency        string
+	Category        string
+	TransactionType string
+	SpenderID       *int64
+}
+
+// ParseFilter reads the transaction filter query parameters from the request.
+// Dates accept either YYYY-MM-DD or RFC3339, a bare `to` date includes the whole day.
+func ParseFilter(c echo.Context) (Filter, error) {
+	return ParseFilterIn(c, time.UTC)
+}
+
+// ParseFilterIn is ParseFilter reading bare dates as days in loc.
+func ParseFilterIn(c echo.Context, loc *time.Location) (Filter, error) {
+	var f Filter
+	var err error
+
+	if f.From, err = parseDate("from", c.QueryParam("from"), false, loc); err != nil {
+		return Filter{}, err
+	}
+	if f.To, err = parseDate("to", c.QueryParam("to"), true, loc); err != nil {
+		return Filter{}, err
+	}
+	if f.From != nil && f.To != nil && f.To.Before(*f.From) {
+		return Filter{}, errors.New("to must not be before from")
+	}
+
+	if f.Amount, err = parseAmount("amount", c.QueryParam("amount")); err != nil {
+		return Filter{}, err
+	}
+	if f.MinAmount, err = parseAmount("min_amount", c.QueryParam("min_amount")); err != nil {
+		return Filter{}, err
+	}
+	if f.MaxAmount, err = parseAmount("max_amount", c.QueryParam("max_amount")); err != nil {
+		return Filter{}, err
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && *f.MaxAmount < *f.MinAmount {
+		return Filter{}, errors.New("max_amount must not be less than min_amount")
+	}
+
+	if v := c.QueryParam("currency"); v != "" {
+		if f.Currency, err = money.NormalizeCurrency(v); err != nil {
+			return Filter{}, err
+		}
+	}
+
+	f.Category = strings.TrimSpace(c.QueryParam("category"))
+
+	f.TransactionType = c.QueryParam("transaction_type")
+	if f.TransactionType != "" && f.TransactionType != "income" && f.TransactionType != "expense" {
+		return Filter{}, fmt.Errorf("invalid transaction_type %q: must be income or expense", f.TransactionType)
+	}
+
+	if v := c.QueryParam("spender_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return Filter{}, fmt.Errorf("invalid spender_id %q: must be a positive integer", v)
+		}
+		f.SpenderID = &id
+	}
+
+	return f, nil
+}
+
+// Where builds a parameterised WHERE clause for the filter. Placeholders are
+// numbered from argOffset+1 so the clause can be appended to queries that
+// already carry arguments. An empty filter returns an empty clause.
+func (f Filter) Where(argOffset int) (string, []any) {
+	var conds []string
+	var args []any
+
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, argOffset+len(args)))
+	}
+
+	if f.From != nil {
+		add("date >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("date <= $%d", *f.To)
+	}
+	if f.Amount != nil {
+		add("amount = $%d", *f.Amount)
+	}
+	if f.MinAmount != nil {
+		add("amount >= $%d", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("amount <= $%d", *f.MaxAmount)
+	}
+	if f.Currency != "" {
+		add("currency = $%d", f.Currency)
+	}
+	if f.Category != "" {
+		add("category = $%d", f.Category)
+	}
+	if f.TransactionType != "" {
+		add("transaction_type = $%d", f.TransactionType)
+	}
+	if f.SpenderID != nil {
+		add("spender_id = $%d", *f.SpenderID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func parseDate(name, v string, endOfDay bool, loc *time.Location) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation(dateLayout, v, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: must be YYYY-MM-DD or RFC3339", name, v)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+func parseAmount(name, v string) (*money.Amount, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	a, err := money.Parse(v)
+	if err != nil || a < 0 {
+		return nil, fmt.Errorf("invalid %s %q: must be a non-negative amount with at most two decimals", name, v)
+	}
+	return &a, nil
+}
@@ -0,0 +1,88 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilterContext(query string) echo.Context {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/transactions?"+query, nil)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec)
+}
+
+func TestParseFilter(t *testing.T) {
+	t.Run("empty query returns empty filter", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext(""))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Filter{}, f)
+	})
+
+	t.Run("parse every supported parameter", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext("from=2024-05-01&to=2024-05-31&amount=100&min_amount=50&max_amount=150.5&category=Food&transaction_type=expense&spender_id=2"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *f.From)
+		assert.Equal(t, time.Date(2024, 5, 31, 23, 59, 59, 999999999, time.UTC), *f.To)
+		assert.Equal(t, money.Amount(100_00), *f.Amount)
+		assert.Equal(t, money.Amount(50_00), *f.MinAmount)
+		assert.Equal(t, money.Amount(150_50), *f.MaxAmount)
+		assert.Equal(t, "Food", f.Category)
+		assert.Equal(t, "expense", f.TransactionType)
+		assert.Equal(t, int64(2), *f.SpenderID)
+	})
+
+	t.Run("accept RFC3339 dates", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext("from=2024-05-01T09:00:00Z"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), *f.From)
+	})
+
+	invalid := map[string]string{
+		"malformed from":           "from=01-05-2024",
+		"malformed to":             "to=tomorrow",
+		"to before from":           "from=2024-05-02&to=2024-05-01",
+		"malformed amount":         "amount=ten",
+		"negative min_amount":      "min_amount=-1",
+		"max_amount below min":     "min_amount=10&max_amount=5",
+		"unknown transaction_type": "transaction_type=foo",
+		"malformed spender_id":     "spender_id=abc",
+		"non positive spender_id":  "spender_id=0",
+	}
+	for name, query := range invalid {
+		t.Run("reject "+name, func(t *testing.T) {
+			_, err := ParseFilter(newFilterContext(query))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	t.Run("empty filter returns empty clause", func(t *testing.T) {
+		where, args := Filter{}.Where(0)
+
+		assert.Equal(t, "", where)
+		assert.Nil(t, args)
+	})
+
+	t.Run("number placeholders from the given offset", func(t *testing.T) {
+		amount := money.Amount(100_00)
+		spender := int64(1)
+		f := Filter{Amount: &amount, Category: "Food", SpenderID: &spender}
+
+		where, args := f.Where(1)
+
+		assert.Equal(t, " WHERE amount = $2 AND category = $3 AND spender_id = $4", where)
+		assert.Equal(t, []any{money.Amount(100_00), "Food", int64(1)}, args)
+	})
+}
@@ -0,0 +1,80 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 100
+)
+
+type Page struct {
+	Number int
+	Limit  int
+
+	// Keyset switches to cursor pagination, Cursor is nil on the first page.
+	Keyset bool
+	Cursor *Cursor
+}
+
+// ParsePage reads the page and limit query parameters. Missing values fall
+// back to the first page of DefaultLimit items and limit is capped at MaxLimit.
+// Cursor pagination is opted into with mode=cursor or by passing a cursor.
+func ParsePage(c echo.Context) (Page, error) {
+	p := Page{Number: 1, Limit: DefaultLimit}
+
+	switch mode := c.QueryParam("mode"); mode {
+	case "", "offset":
+	case "cursor":
+		p.Keyset = true
+	default:
+		return Page{}, fmt.Errorf("invalid mode %q: must be offset or cursor", mode)
+	}
+
+	if v := c.QueryParam("cursor"); v != "" {
+		cur, err := DecodeCursor(v)
+		if err != nil {
+			return Page{}, err
+		}
+		p.Keyset = true
+		p.Cursor = &cur
+	}
+
+	if v := c.QueryParam("page"); v != "" {
+		if p.Keyset {
+			return Page{}, errors.New("page cannot be combined with cursor pagination")
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Page{}, fmt.Errorf("invalid page %q: must be a positive integer", v)
+		}
+		p.Number = n
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Page{}, fmt.Errorf("invalid limit %q: must be a positive integer", v)
+		}
+		p.Limit = min(n, MaxLimit)
+	}
+
+	return p, nil
+}
+
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Limit
+}
+
+func (p Page) Pagination(total int) Pagination {
+	return Pagination{
+		CurrentPage: p.Number,
+		TotalPage:   (total + p.Limit - 1) / p.Limit,
+		PerPage:     p.Limit,
+	}
+}
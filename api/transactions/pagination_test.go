@@ -0,0 +1,47 @@
+package transactions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage(t *testing.T) {
+	t.Run("default to first page of ten items", func(t *testing.T) {
+		p, err := ParsePage(newFilterContext(""))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Page{Number: 1, Limit: DefaultLimit}, p)
+		assert.Equal(t, 0, p.Offset())
+	})
+
+	t.Run("compute offset from page and limit", func(t *testing.T) {
+		p, err := ParsePage(newFilterContext("page=3&limit=20"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 40, p.Offset())
+	})
+
+	t.Run("cap limit at the maximum", func(t *testing.T) {
+		p, err := ParsePage(newFilterContext("limit=1000"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, MaxLimit, p.Limit)
+	})
+
+	for _, query := range []string{"page=0", "page=abc", "limit=0", "limit=-5"} {
+		t.Run("reject "+query, func(t *testing.T) {
+			_, err := ParsePage(newFilterContext(query))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPagePagination(t *testing.T) {
+	p := Page{Number: 2, Limit: 10}
+
+	assert.Equal(t, Pagination{CurrentPage: 2, TotalPage: 0, PerPage: 10}, p.Pagination(0))
+	assert.Equal(t, Pagination{CurrentPage: 2, TotalPage: 1, PerPage: 10}, p.Pagination(10))
+	assert.Equal(t, Pagination{CurrentPage: 2, TotalPage: 3, PerPage: 10}, p.Pagination(21))
+}
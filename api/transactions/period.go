@@ -0,0 +1,134 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/report"
+)
+
+// Intervals a period summary buckets transactions by.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// MaxPeriods is the most periods a summary reports, a range spanning more
+// fails with ErrTooManyPeriods.
+const MaxPeriods = 1000
+
+// ErrTooManyPeriods is returned when a range spans more than MaxPeriods
+// intervals.
+var ErrTooManyPeriods = errors.New("too many periods")
+
+// ValidInterval reports whether interval is one of the intervals.
+func ValidInterval(interval string) bool {
+	return interval == IntervalDay || interval == IntervalWeek || interval == IntervalMonth || interval == IntervalYear
+}
+
+// PeriodTotal totals one transaction type of a period, Average is the
+// average transaction amount.
+type PeriodTotal struct {
+	Total   money.Amount `json:"total"`
+	Count   int          `json:"count"`
+	Average money.Amount `json:"average"`
+}
+
+type PeriodSummary struct {
+	Start   time.Time   `json:"start"`
+	Income  PeriodTotal `json:"income"`
+	Expense PeriodTotal `json:"expense"`
+}
+
+// PeriodAverage is the average total of a period, such as the average
+// amount spent per day.
+type PeriodAverage struct {
+	Income  money.Amount `json:"income"`
+	Expense money.Amount `json:"expense"`
+}
+
+type Periods struct {
+	Periods []PeriodSummary `json:"periods"`
+	Average PeriodAverage   `json:"average"`
+}
+
+// periodStmt totals the transactions %s lists, converted to the base
+// currency $1 with report.Converted, per interval $2 starting in the
+// timezone $3. Periods without transactions are generated with zero totals,
+// from $4 to $5 or from the first to the last transaction when they are
+// NULL, and at most %d of them. The last column counts transactions that
+// have no rate.
+const periodStmt = `WITH c AS (
+	SELECT date_trunc($2, date AT TIME ZONE $3) AS bucket, transaction_type, amount, missing
+	FROM (%s
+		WHERE t.transaction_type IN ('income', 'expense')) t
+), b AS (
+	SELECT generate_series(
+		COALESCE(date_trunc($2, $4::timestamptz AT TIME ZONE $3), MIN(bucket)),
+		COALESCE(date_trunc($2, $5::timestamptz AT TIME ZONE $3), MAX(bucket)),
+		('1 ' || $2)::interval) AS bucket
+	FROM c
+	LIMIT %d
+)
+SELECT b.bucket AT TIME ZONE $3,
+	COALESCE(SUM(c.amount) FILTER (WHERE c.transaction_type = 'income'), 0),
+	COUNT(*) FILTER (WHERE c.transaction_type = 'income'),
+	COALESCE(ROUND(AVG(c.amount) FILTER (WHERE c.transaction_type = 'income'), 2), 0),
+	COALESCE(SUM(c.amount) FILTER (WHERE c.transaction_type = 'expense'), 0),
+	COUNT(*) FILTER (WHERE c.transaction_type = 'expense'),
+	COALESCE(ROUND(AVG(c.amount) FILTER (WHERE c.transaction_type = 'expense'), 2), 0),
+	ROUND(AVG(COALESCE(SUM(c.amount) FILTER (WHERE c.transaction_type = 'income'), 0)) OVER (), 2),
+	ROUND(AVG(COALESCE(SUM(c.amount) FILTER (WHERE c.transaction_type = 'expense'), 0)) OVER (), 2),
+	COUNT(*) FILTER (WHERE c.missing)
+FROM b LEFT JOIN c ON c.bucket = b.bucket
+GROUP BY b.bucket
+ORDER BY b.bucket`
+
+// periodQuery is periodStmt over the transactions matching where, generating
+// one period more than MaxPeriods to tell when a range spans too many.
+func periodQuery(where string) string {
+	return fmt.Sprintf(periodStmt, report.Converted("(SELECT * FROM transaction"+where+")", "$1"), MaxPeriods+1)
+}
+
+// PeriodSummary buckets the transactions matching f by interval in loc,
+// totalled in the base currency. It returns ErrMissingRate when a
+// transaction cannot be converted and ErrTooManyPeriods when the range spans
+// more than MaxPeriods intervals.
+func (h handler) PeriodSummary(ctx context.Context, f Filter, base, interval string, loc *time.Location) (Periods, error) {
+	where, args := f.Where(5)
+	args = append([]any{base, interval, loc.String(), f.From, f.To}, args...)
+	rows, err := h.db.QueryContext(ctx, periodQuery(where), args...)
+	if err != nil {
+		return Periods{}, err
+	}
+	defer rows.Close()
+
+	ps := Periods{Periods: []PeriodSummary{}}
+	for rows.Next() {
+		if len(ps.Periods) == MaxPeriods {
+			return Periods{}, fmt.Errorf("%w: the range spans more than %d %ss", ErrTooManyPeriods, MaxPeriods, interval)
+		}
+		var p PeriodSummary
+		var missing int
+		err := rows.Scan(&p.Start,
+			&p.Income.Total, &p.Income.Count, &p.Income.Average,
+			&p.Expense.Total, &p.Expense.Count, &p.Expense.Average,
+			&ps.Average.Income, &ps.Average.Expense,
+			&missing)
+		if err != nil {
+			return Periods{}, err
+		}
+		if missing > 0 {
+			return Periods{}, fmt.Errorf("%w to %s for %d transactions from %s", ErrMissingRate, base, missing, p.Start.In(loc).Format(dateLayout))
+		}
+		p.Start = p.Start.In(loc)
+		ps.Periods = append(ps.Periods, p)
+	}
+
+	return ps, rows.Err()
+}
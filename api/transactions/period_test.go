@@ -0,0 +1,84 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodSummary(t *testing.T) {
+	columns := []string{"start", "income", "income_count", "income_average", "expense", "expense_count", "expense_average", "average_income", "average_expense", "missing"}
+	bangkok, _ := time.LoadLocation("Asia/Bangkok")
+	id := int64(1)
+	from := time.Date(2024, 5, 12, 0, 0, 0, 0, bangkok)
+	to := time.Date(2024, 5, 14, 0, 0, 0, 0, bangkok).Add(-time.Nanosecond)
+	f := Filter{From: &from, To: &to, SpenderID: &id}
+	query := periodQuery(" WHERE date >= $6 AND date <= $7 AND spender_id = $8")
+
+	t.Run("total each period and fill the empty ones", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(query).
+			WithArgs("THB", IntervalDay, "Asia/Bangkok", &from, &to, from, to, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(from.UTC(), "200.00", 1, "200.00", "150.00", 2, "75.00", "100.00", "75.00", 0).
+				AddRow(from.AddDate(0, 0, 1).UTC(), "0", 0, "0", "0", 0, "0", "100.00", "75.00", 0))
+
+		got, err := New(config.FeatureFlag{}, db).PeriodSummary(context.Background(), f, "THB", IntervalDay, bangkok)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Periods{
+			Periods: []PeriodSummary{
+				{Start: from, Income: PeriodTotal{Total: 20000, Count: 1, Average: 20000}, Expense: PeriodTotal{Total: 15000, Count: 2, Average: 7500}},
+				{Start: from.AddDate(0, 0, 1)},
+			},
+			Average: PeriodAverage{Income: 10000, Expense: 7500},
+		}, got)
+	})
+
+	t.Run("report no transactions as no periods", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(periodQuery(" WHERE spender_id = $6")).
+			WithArgs("THB", IntervalMonth, "UTC", nil, nil, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		got, err := New(config.FeatureFlag{}, db).PeriodSummary(context.Background(), Filter{SpenderID: &id}, "THB", IntervalMonth, time.UTC)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Periods{Periods: []PeriodSummary{}}, got)
+	})
+
+	t.Run("fail when an exchange rate is missing", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(query).
+			WithArgs("THB", IntervalDay, "Asia/Bangkok", &from, &to, from, to, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(from.UTC(), "0", 0, "0", "0", 1, "0", "0", "0", 1))
+
+		_, err := New(config.FeatureFlag{}, db).PeriodSummary(context.Background(), f, "THB", IntervalDay, bangkok)
+
+		assert.ErrorIs(t, err, ErrMissingRate)
+	})
+
+	t.Run("fail when the range spans too many periods", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		rows := sqlmock.NewRows(columns)
+		for i := 0; i <= MaxPeriods; i++ {
+			rows.AddRow(from.AddDate(0, 0, i).UTC(), "0", 0, "0", "0", 0, "0", "0", "0", 0)
+		}
+		mock.ExpectQuery(query).
+			WithArgs("THB", IntervalDay, "Asia/Bangkok", &from, &to, from, to, int64(1)).
+			WillReturnRows(rows)
+
+		_, err := New(config.FeatureFlag{}, db).PeriodSummary(context.Background(), f, "THB", IntervalDay, bangkok)
+
+		assert.ErrorIs(t, err, ErrTooManyPeriods)
+	})
+}
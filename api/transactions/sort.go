@@ -0,0 +1,84 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sortColumns whitelists the sort keys clients may use, mapped to their column.
+var sortColumns = map[string]string{
+	"date":     "date",
+	"amount":   "amount",
+	"category": "category",
+	"id":       "id",
+}
+
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+type Sort []SortKey
+
+// DefaultSort lists the newest transactions first.
+var DefaultSort = Sort{{Column: "date", Desc: true}, {Column: "id", Desc: true}}
+
+// ParseSort reads a comma separated list of sort keys such as sort=-date,amount
+// where a leading minus sorts descending. Without a sort parameter DefaultSort
+// is returned. Cursor pagination always uses DefaultSort.
+func ParseSort(c echo.Context) (Sort, error) {
+	v := c.QueryParam("sort")
+	if v == "" {
+		return DefaultSort, nil
+	}
+	if c.QueryParam("mode") == "cursor" || c.QueryParam("cursor") != "" {
+		return nil, errors.New("sort cannot be combined with cursor pagination")
+	}
+
+	var s Sort
+	seen := map[string]bool{}
+	for _, key := range strings.Split(v, ",") {
+		key = strings.TrimSpace(key)
+
+		desc := strings.HasPrefix(key, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(key, "-"), "+")
+
+		col, ok := sortColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort key %q: must be one of date, amount, category, id", key)
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("duplicate sort key %q", name)
+		}
+		seen[col] = true
+		s = append(s, SortKey{Column: col, Desc: desc})
+	}
+
+	return s, nil
+}
+
+// OrderBy renders the ORDER BY clause. id is appended as a final tie breaker
+// so that rows with equal sort values keep a stable order between pages.
+func (s Sort) OrderBy() string {
+	keys := make([]string, 0, len(s)+1)
+	hasID := false
+	for _, k := range s {
+		keys = append(keys, k.Column+direction(k.Desc))
+		hasID = hasID || k.Column == "id"
+	}
+	if !hasID {
+		keys = append(keys, "id ASC")
+	}
+
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
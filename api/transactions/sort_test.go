@@ -0,0 +1,83 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSort(t *testing.T) {
+	t.Run("default to newest first", func(t *testing.T) {
+		s, err := ParseSort(newFilterContext(""))
+
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSort, s)
+		assert.Equal(t, " ORDER BY date DESC, id DESC", s.OrderBy())
+	})
+
+	t.Run("parse multiple keys with directions", func(t *testing.T) {
+		s, err := ParseSort(newFilterContext("sort=-date,amount,-category"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Sort{{Column: "date", Desc: true}, {Column: "amount"}, {Column: "category", Desc: true}}, s)
+		assert.Equal(t, " ORDER BY date DESC, amount ASC, category DESC, id ASC", s.OrderBy())
+	})
+
+	t.Run("keep explicit id key as tie breaker", func(t *testing.T) {
+		s, err := ParseSort(newFilterContext("sort=-id"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, " ORDER BY id DESC", s.OrderBy())
+	})
+
+	invalid := map[string]string{
+		"unknown column":      "sort=note",
+		"sql injection":       "sort=date%3BDROP%20TABLE%20transaction",
+		"empty key":           "sort=date,,amount",
+		"duplicate key":       "sort=date,-date",
+		"cursor pagination":   "sort=amount&mode=cursor",
+		"cursor continuation": "sort=amount&cursor=abc",
+	}
+	for name, query := range invalid {
+		t.Run("reject "+name, func(t *testing.T) {
+			_, err := ParseSort(newFilterContext(query))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGetAllTransactionSorted(t *testing.T) {
+	e := echo.New()
+	defer e.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/transactions?sort=-amount,date", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	auth.SetIdentity(c, admin)
+
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+	mock.ExpectQuery(sumStmt + sumGroup).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 1, 0, 100))
+	mock.ExpectQuery(lStmt+` ORDER BY amount DESC, date ASC, id ASC LIMIT $1 OFFSET $2`).
+		WithArgs(10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 100, "THB", "Food", "expense", "", "", 1, ""))
+
+	h := New(config.FeatureFlag{}, db)
+	err := h.GetAll(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
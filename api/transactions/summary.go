@@ -0,0 +1,128 @@
+package transactions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/report"
+	"github.com/labstack/echo/v4"
+)
+
+// ParseRange reads the from and to query parameters like ParseFilter does.
+func ParseRange(c echo.Context) (report.Range, error) {
+	from, err := parseDate("from", c.QueryParam("from"), false, time.UTC)
+	if err != nil {
+		return report.Range{}, err
+	}
+	to, err := parseDate("to", c.QueryParam("to"), true, time.UTC)
+	if err != nil {
+		return report.Range{}, err
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return report.Range{}, errors.New("to must not be before from")
+	}
+	return report.Range{From: from, To: to}, nil
+}
+
+// ExpenseSummary reports the total, average per day and count of the
+// caller's expenses.
+func (h handler) ExpenseSummary(c echo.Context) error {
+	return h.summary(c, "expense")
+}
+
+// IncomeSummary reports the total, average per day and count of the
+// caller's income.
+func (h handler) IncomeSummary(c echo.Context) error {
+	return h.summary(c, "income")
+}
+
+func (h handler) summary(c echo.Context, tType string) error {
+	ctx := c.Request().Context()
+	reports := report.New(h.db)
+	of, err := reportOf(c, reports)
+	if err != nil {
+		return err
+	}
+
+	sum, err := reports.Summary(ctx, of.spender, tType, of.base, of.r)
+	if errors.Is(err, report.ErrMissingRate) {
+		return problem.Unprocessable(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, sum)
+}
+
+// Balance reports what the caller earned, spent and saved.
+func (h handler) Balance(c echo.Context) error {
+	ctx := c.Request().Context()
+	reports := report.New(h.db)
+	of, err := reportOf(c, reports)
+	if err != nil {
+		return err
+	}
+
+	b, err := reports.Balance(ctx, of.spender, of.base, of.r)
+	if errors.Is(err, report.ErrMissingRate) {
+		return problem.Unprocessable(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, b)
+}
+
+// subject is what a summary is of.
+type subject struct {
+	spender int64
+	base    string
+	r       report.Range
+}
+
+// reportOf reads the subject of a summary: the caller's own spender, or the
+// spender_id query parameter for callers that reach every spender, with
+// their base currency and the date range.
+func reportOf(c echo.Context, reports *report.Service) (subject, error) {
+	own, err := scope(c)
+	if err != nil {
+		return subject{}, err
+	}
+
+	var of subject
+	switch v := c.QueryParam("spender_id"); {
+	case own != nil:
+		of.spender = *own
+		if v != "" && v != strconv.FormatInt(of.spender, 10) {
+			return subject{}, errOtherSpender
+		}
+	case v == "":
+		return subject{}, problem.BadRequest(errors.New("spender_id is required"))
+	default:
+		of.spender, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || of.spender <= 0 {
+			return subject{}, problem.BadRequest(fmt.Errorf("invalid spender_id %q: must be a positive integer", v))
+		}
+	}
+
+	if of.r, err = ParseRange(c); err != nil {
+		return subject{}, problem.BadRequest(err)
+	}
+
+	of.base, err = reports.BaseCurrency(c.Request().Context(), of.spender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return subject{}, problem.NotFound("spender not found")
+	}
+	if err != nil {
+		return subject{}, err
+	}
+
+	return of, nil
+}
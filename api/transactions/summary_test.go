@@ -0,0 +1,122 @@
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaries(t *testing.T) {
+	newContext := func(identity auth.Identity, query string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validate.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/expenses/summary?"+query, nil), rec)
+		auth.SetIdentity(c, identity)
+		return c, rec
+	}
+	base := func(mock sqlmock.Sqlmock, id int64) {
+		mock.ExpectQuery(`SELECT base_currency FROM spender`).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("THB"))
+	}
+
+	t.Run("summarise the caller's expenses", func(t *testing.T) {
+		c, rec := newContext(spender, "from=2024-05-01&to=2024-05-31")
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		base(mock, 1)
+		mock.ExpectQuery(`WITH c AS`).
+			WithArgs(int64(1), "THB", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), "expense").
+			WillReturnRows(sqlmock.NewRows([]string{"total", "average", "count", "missing"}).AddRow("1550.00", "50.00", 12, 0))
+
+		err := New(config.FeatureFlag{}, db).ExpenseSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"currency": "THB", "total_amount": 1550, "average_per_day": 50, "count": 12}`, rec.Body.String())
+	})
+
+	t.Run("summarise the income of the spender an admin names", func(t *testing.T) {
+		c, rec := newContext(admin, "spender_id=2")
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		base(mock, 2)
+		mock.ExpectQuery(`WITH c AS`).WithArgs(int64(2), "THB", nil, nil, "income").
+			WillReturnRows(sqlmock.NewRows([]string{"total", "average", "count", "missing"}).AddRow("2105.00", "2105.00", 12, 0))
+
+		err := New(config.FeatureFlag{}, db).IncomeSummary(c)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"currency": "THB", "total_amount": 2105, "average_per_day": 2105, "count": 12}`, rec.Body.String())
+	})
+
+	t.Run("balance the caller's income and expenses", func(t *testing.T) {
+		c, rec := newContext(spender, "")
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		base(mock, 1)
+		mock.ExpectQuery(`WITH c AS`).WithArgs(int64(1), "THB", nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expense", "missing"}).AddRow("2755.00", "1870.00", 0))
+
+		err := New(config.FeatureFlag{}, db).Balance(c)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"currency": "THB", "total_income": 2755, "total_expenses": 1870, "current_balance": 885}`, rec.Body.String())
+	})
+
+	t.Run("fail when an exchange rate is missing", func(t *testing.T) {
+		c, _ := newContext(spender, "")
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		base(mock, 1)
+		mock.ExpectQuery(`WITH c AS`).WithArgs(int64(1), "THB", nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"income", "expense", "missing"}).AddRow("0", "0", 1))
+
+		err := New(config.FeatureFlag{}, db).Balance(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+	})
+
+	t.Run("report a missing spender", func(t *testing.T) {
+		c, _ := newContext(admin, "spender_id=9")
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery(`SELECT base_currency FROM spender`).WithArgs(int64(9)).
+			WillReturnRows(sqlmock.NewRows([]string{"base_currency"}))
+
+		err := New(config.FeatureFlag{}, db).Balance(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	for name, tc := range map[string]struct {
+		identity auth.Identity
+		query    string
+		status   int
+	}{
+		"admin names no spender":        {admin, "", http.StatusBadRequest},
+		"spender_id is malformed":       {admin, "spender_id=abc", http.StatusBadRequest},
+		"spender names another spender": {spender, "spender_id=2", http.StatusForbidden},
+		"to is before from":             {spender, "from=2024-05-31&to=2024-05-01", http.StatusBadRequest},
+		"from is malformed":             {spender, "from=yesterday", http.StatusBadRequest},
+	} {
+		t.Run("fail when "+name, func(t *testing.T) {
+			c, _ := newContext(tc.identity, tc.query)
+			db, _, _ := sqlmock.New()
+			defer db.Close()
+
+			err := New(config.FeatureFlag{}, db).ExpenseSummary(c)
+
+			assert.Equal(t, tc.status, problem.Status(err))
+		})
+	}
+}
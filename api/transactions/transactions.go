@@ -1,43 +1,64 @@
 package transactions
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/patch"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/report"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
+// Transaction is a recorded income or expense. ImageUrl is free text kept
+// for older clients, slips are linked as attachments instead. Reference is
+// the bank reference of the slip it was paid with, if known.
 type Transaction struct {
-	ID              int64     `json:"id"`
-	Date            time.Time `json:"date"`
-	Amount          float64   `json:"amount"`
-	Category        string    `json:"category"`
-	TransactionType string    `json:"transaction_type"`
-	Note            string    `json:"note"`
-	ImageUrl        string    `json:"image_url"`
-	SpenderID       int64     `json:"spender_id"`
+	ID              int64        `json:"id"`
+	Date            time.Time    `json:"date" validate:"required"`
+	Amount          money.Amount `json:"amount" validate:"amount"`
+	Currency        string       `json:"currency" validate:"currency"`
+	Category        string       `json:"category" validate:"required,max=50"`
+	TransactionType string       `json:"transaction_type" validate:"required,oneof=income expense"`
+	Note            string       `json:"note" validate:"max=255"`
+	ImageUrl        string       `json:"image_url" validate:"max=255"`
+	SpenderID       int64        `json:"spender_id" validate:"required,gt=0"`
+	Reference       string       `json:"reference,omitempty" validate:"max=64"`
 }
 
+// Summary totals transactions of one currency, amounts of different
+// currencies are never added together.
 type Summary struct {
-	TotalIncome    float64 `json:"total_income"`
-	TotalExpenses  float64 `json:"total_expenses"`
-	CurrentBalance float64 `json:"current_balance"`
+	Currency       string       `json:"currency,omitempty"`
+	TotalIncome    money.Amount `json:"total_income"`
+	TotalExpenses  money.Amount `json:"total_expenses"`
+	CurrentBalance money.Amount `json:"current_balance"`
 }
 
 type Pagination struct {
-	CurrentPage int `json:"current_page"`
-	TotalPage   int `json:"total_pages"`
-	PerPage     int `json:"per_page"`
+	CurrentPage int    `json:"current_page"`
+	TotalPage   int    `json:"total_pages"`
+	PerPage     int    `json:"per_page"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
 }
 
 type T struct {
 	Transections []Transaction `json:"transections"`
-	Summary      Summary       `json:"summary"`
+	Summary      []Summary     `json:"summary"`
 	Pagination   Pagination    `json:"pagination"`
 }
 
@@ -51,110 +72,411 @@ func New(cfg config.FeatureFlag, db *sql.DB) *handler {
 }
 
 const (
-	cStmt = `INSERT INTO transaction (date, amount, category, transaction_type, note,image_url, spender_id) VALUES ($1, $2,$3, $4, $5, $6,$7) RETURNING id;`
-	uStmt = `UPDATE transaction SET date = $1, amount = $2, category = $3, transaction_type = $4, note = $5, image_url = $6, spender_id = $7 WHERE id = $8;`
+	cStmt    = `INSERT INTO transaction (date, amount, currency, category, transaction_type, note, image_url, spender_id, reference) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	lStmt    = `SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction`
+	sumStmt  = `SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction`
+	sumGroup = ` GROUP BY currency ORDER BY currency`
+	gStmt    = lStmt + ` WHERE id = $1`
+	dStmt    = `DELETE FROM transaction WHERE id = $1;`
+	uStmt    = `UPDATE transaction SET date = $1, amount = $2, currency = $3, category = $4, transaction_type = $5, note = $6, image_url = $7, spender_id = $8, reference = $9 WHERE id = $10;`
+
+	// dOwnStmt and uOwnStmt only touch a transaction of the caller's spender.
+	dOwnStmt = `DELETE FROM transaction WHERE id = $1 AND spender_id = $2;`
+	uOwnStmt = `UPDATE transaction SET date = $1, amount = $2, currency = $3, category = $4, transaction_type = $5, note = $6, image_url = $7, spender_id = $8, reference = $9 WHERE id = $10 AND spender_id = $8;`
 )
 
+// ErrMissingRate is returned by the summaries when a transaction cannot be
+// converted, see report.ErrMissingRate.
+var ErrMissingRate = report.ErrMissingRate
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransaction(row scanner, t *Transaction) error {
+	return row.Scan(&t.ID, &t.Date, &t.Amount, &t.Currency, &t.Category, &t.TransactionType, &t.Note, &t.ImageUrl, &t.SpenderID, &t.Reference)
+}
+
+// scope returns the spender whose transactions the caller is limited to, nil
+// when the caller may reach every spender's transactions.
+func scope(c echo.Context) (*int64, error) {
+	id, ok := auth.FromContext(c)
+	if !ok {
+		return nil, problem.Unauthorized("missing identity")
+	}
+	return id.SpenderScope(), nil
+}
+
+func owns(scope *int64, spender int64) bool {
+	return scope == nil || *scope == spender
+}
+
+var errOtherSpender = problem.Forbidden("transactions of another spender are not allowed")
+
+// errForeignKey is the Postgres code of a foreign key violation.
+const errForeignKey = "23503"
+
+// SpenderError turns the foreign key violation of a transaction recorded for
+// a spender that does not exist, or was deleted, into a 422. Other errors
+// are returned as they are.
+func SpenderError(err error, spender int64) error {
+	var perr *pq.Error
+	if errors.As(err, &perr) && perr.Code == errForeignKey {
+		return problem.Unprocessable(fmt.Errorf("spender %d does not exist", spender))
+	}
+	return err
+}
+
 func (h handler) GetAll(c echo.Context) error {
-	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`)
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+
+	f, err := ParseFilter(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	if own != nil {
+		if f.SpenderID != nil && *f.SpenderID != *own {
+			return errOtherSpender
+		}
+		f.SpenderID = own
+	}
+	s, err := ParseSort(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	p, err := ParsePage(c)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	res, err := h.List(ctx, f, s, p)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// List returns one page of the transactions matching f ordered by s, together
+// with the summaries, one per currency, and pagination computed over every
+// matching row. Cursor
+// pages ignore s and always follow DefaultSort.
+func (h handler) List(ctx context.Context, f Filter, s Sort, p Page) (T, error) {
+	where, args := f.Where(0)
+
+	total, sum, err := h.summarize(ctx, where, args...)
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return T{}, err
+	}
+
+	if p.Keyset {
+		query, args := keyset(where, args, p.Cursor, p.Limit)
+		ts, err := h.query(ctx, query, args...)
+		if err != nil {
+			return T{}, err
+		}
+
+		ts, pg := cursorPage(ts, p.Cursor, p.Limit)
+		return T{Transections: ts, Summary: sum, Pagination: pg}, nil
+	}
+
+	n := len(args)
+	args = append(args, p.Limit, p.Offset())
+	ts, err := h.query(ctx, fmt.Sprintf("%s%s%s LIMIT $%d OFFSET $%d", lStmt, where, s.OrderBy(), n+1, n+2), args...)
+	if err != nil {
+		return T{}, err
+	}
+
+	return T{
+		Transections: ts,
+		Summary:      sum,
+		Pagination:   p.Pagination(total),
+	}, nil
+}
+
+// summarize counts the transactions matching where and totals them by
+// currency.
+func (h handler) summarize(ctx context.Context, where string, args ...any) (int, []Summary, error) {
+	rows, err := h.db.QueryContext(ctx, sumStmt+where+sumGroup, args...)
+	if err != nil {
+		return 0, nil, err
 	}
 	defer rows.Close()
 
-	var transactions []Transaction
+	total := 0
+	ss := []Summary{}
 	for rows.Next() {
-		var t Transaction
-
-		if err := rows.Scan(&t.ID, &t.Date, &t.Amount, &t.Category, &t.TransactionType, &t.Note, &t.ImageUrl, &t.SpenderID); err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
+		var n int
+		var s Summary
+		if err := rows.Scan(&s.Currency, &n, &s.TotalIncome, &s.TotalExpenses); err != nil {
+			return 0, nil, err
 		}
+		s.CurrentBalance = s.TotalIncome - s.TotalExpenses
+		total += n
+		ss = append(ss, s)
+	}
+	return total, ss, rows.Err()
+}
 
-		transactions = append(transactions, t)
+func (h handler) query(ctx context.Context, query string, args ...any) ([]Transaction, error) {
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return c.JSON(http.StatusOK, transactions)
+	ts := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, rows.Err()
 }
 
 func (h handler) Create(c echo.Context) error {
-	logger := mlog.L(c)
 	ctx := c.Request().Context()
 	var t Transaction
 	err := c.Bind(&t)
 	if err != nil {
-		logger.Error("bad request body", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return problem.BadRequest(err)
+	}
+	normalize(&t)
+	if err := c.Validate(t); err != nil {
+		return err
+	}
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+	if !owns(own, t.SpenderID) {
+		return errOtherSpender
+	}
+
+	// clients, such as the receipt extractor, retry on timeouts
+	dup, err := FindDuplicate(ctx, h.db, t)
+	if err == nil {
+		return Duplicate(dup)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
 	}
 
 	var lastInsertId int64
-	err = h.db.QueryRowContext(ctx, cStmt, t.Date, t.Amount, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID).Scan(&lastInsertId)
+	err = h.db.QueryRowContext(ctx, cStmt, t.Date, t.Amount, t.Currency, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID, t.Reference).Scan(&lastInsertId)
 	if err != nil {
-		logger.Error("query row error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return SpenderError(err, t.SpenderID)
 	}
 
 	return c.JSON(http.StatusCreated, Transaction{
 		ID:              lastInsertId,
 		Date:            t.Date,
 		Amount:          t.Amount,
+		Currency:        t.Currency,
 		Category:        t.Category,
 		TransactionType: t.TransactionType,
 		Note:            t.Note,
 		ImageUrl:        t.ImageUrl,
 		SpenderID:       t.SpenderID,
+		Reference:       t.Reference,
 	})
 }
 
 func (h handler) Update(c echo.Context) error {
-	logger := mlog.L(c)
 	ctx := c.Request().Context()
 	id := c.Param("id")
 	idi, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		logger.Error("bad request body", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return problem.BadRequest(err)
 	}
 
 	var t Transaction
 	err = c.Bind(&t)
 	if err != nil {
-		logger.Error("bad request body", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return problem.BadRequest(err)
+	}
+	normalize(&t)
+	if err := c.Validate(t); err != nil {
+		return err
+	}
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+	if !owns(own, t.SpenderID) {
+		return errOtherSpender
 	}
 
-	result, err := h.db.ExecContext(ctx, uStmt, t.Date, t.Amount, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID, idi)
+	query := uStmt
+	if own != nil {
+		query = uOwnStmt
+	}
+	result, err := h.db.ExecContext(ctx, query, t.Date, t.Amount, t.Currency, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID, t.Reference, idi)
 	if err != nil {
-		logger.Error("query row error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return SpenderError(err, t.SpenderID)
 	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
-		logger.Error("query row error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	if rows == 0 {
-		return c.JSON(http.StatusNotFound, "transaction not found")
+		return problem.NotFound("transaction not found")
 	}
 
 	t.ID = idi
 	return c.JSON(http.StatusOK, t)
 }
 
-func (h handler) GetSummary(id int, t_type string) (float64, error) {
-	rows := h.db.QueryRow(`SELECT SUM(amount) FROM transaction WHERE spender_id = $1 AND transaction_type = $2`, id, t_type)
+func (h handler) GetByID(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+
+	var t Transaction
+	err = scanTransaction(h.db.QueryRowContext(ctx, gStmt, id), &t)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !owns(own, t.SpenderID) {
+		return problem.NotFound("transaction not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	if own != nil {
+		result, err = h.db.ExecContext(ctx, dOwnStmt, id, *own)
+	} else {
+		result, err = h.db.ExecContext(ctx, dStmt, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return problem.NotFound("transaction not found")
+	}
+
+	logger.Info("delete successfully", zap.Int64("id", id))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to a transaction: only the
+// members present in the body are changed and null resets a member to its
+// zero value. The read and the write share a database transaction so
+// concurrent patches cannot lose each other's changes.
+func (h handler) Patch(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+
+	own, err := scope(c)
+	if err != nil {
+		return err
+	}
+
+	members, err := patch.Bind(c)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var t Transaction
+	err = scanTransaction(tx.QueryRowContext(ctx, gStmt+" FOR UPDATE", id), &t)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !owns(own, t.SpenderID) {
+		return problem.NotFound("transaction not found")
+	}
+	if err != nil {
+		return err
+	}
 
-	sum := 0.0
-	if err := rows.Scan(&sum); err != nil {
-		return 0, err
+	if err := mergePatch(&t, members); err != nil {
+		return problem.BadRequest(err)
 	}
+	normalize(&t)
+	if err := c.Validate(t); err != nil {
+		return err
+	}
+	if !owns(own, t.SpenderID) {
+		return errOtherSpender
+	}
+	t.ID = id
 
-	return sum, nil
+	if _, err := tx.ExecContext(ctx, uStmt, t.Date, t.Amount, t.Currency, t.Category, t.TransactionType, t.Note, t.ImageUrl, t.SpenderID, t.Reference, id); err != nil {
+		return SpenderError(err, t.SpenderID)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+// normalize canonicalises the currency code and slip reference ahead of
+// validation, an omitted currency means money.DefaultCurrency.
+func normalize(t *Transaction) {
+	t.Reference = strings.ToUpper(strings.TrimSpace(t.Reference))
+	t.Currency = strings.ToUpper(strings.TrimSpace(t.Currency))
+	if t.Currency == "" {
+		t.Currency = money.DefaultCurrency
+	}
+}
+
+// mergePatch overlays members on t, see patch.Merge.
+func mergePatch(t *Transaction, members map[string]json.RawMessage) error {
+	fields := map[string]any{
+		"date":             &t.Date,
+		"amount":           &t.Amount,
+		"currency":         &t.Currency,
+		"category":         &t.Category,
+		"transaction_type": &t.TransactionType,
+		"note":             &t.Note,
+		"image_url":        &t.ImageUrl,
+		"spender_id":       &t.SpenderID,
+		"reference":        &t.Reference,
+	}
+	return patch.Merge(fields, members)
 }
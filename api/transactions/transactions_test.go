@@ -1,6 +1,7 @@
 package transactions
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,8 +10,14 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/patch"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,24 +36,34 @@ func initStub(trans Transaction, err error) StubTransaction {
 	return stub
 }
 
+var (
+	admin   = auth.Identity{Role: auth.RoleAdmin}
+	spender = auth.Identity{SpenderID: 1, Role: auth.RoleSpender}
+)
+
 func TestGetAllTransaction(t *testing.T) {
 	t.Run("get all transaction successfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodGet, "/transactions", nil)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
 		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
-		rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-			AddRow(1, dt, 100, "category", "expense", "notes", "http://www", 1).
-			AddRow(2, dt, 200, "category", "expense", "notes", "http://www", 1)
-
-		mock.ExpectQuery(`SELECT id, date, amount, category, transaction_type, note, image_url, spender_id FROM transaction`).
+		rows := sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 100, "THB", "category", "expense", "notes", "http://www", 1, "").
+			AddRow(2, dt, 200, "THB", "category", "expense", "notes", "http://www", 1, "")
+
+		mock.ExpectQuery(`SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction GROUP BY currency ORDER BY currency`).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 2, 0, 300))
+		mock.ExpectQuery(`SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction ORDER BY date DESC, id DESC LIMIT $1 OFFSET $2`).
+			WithArgs(10, 0).
 			WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
@@ -54,11 +71,13 @@ func TestGetAllTransaction(t *testing.T) {
 
 		assert.Nil(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `[
+		assert.JSONEq(t, `{
+		  "transections": [
 			{
 			  "id": 1,
 			  "date": "2024-05-11T09:07:29Z",
 			  "amount": 100,
+			  "currency": "THB",
 			  "category": "category",
 			  "transaction_type": "expense",
 			  "note": "notes",
@@ -69,20 +88,137 @@ func TestGetAllTransaction(t *testing.T) {
 			  "id": 2,
 			  "date": "2024-05-11T09:07:29Z",
 			  "amount": 200,
+			  "currency": "THB",
 			  "category": "category",
 			  "transaction_type": "expense",
 			  "note": "notes",
 			  "image_url": "http://www",
 			  "spender_id": 1
 			}
-		  ]`, rec.Body.String())
+		  ],
+		  "summary": [{
+			"currency": "THB",
+			"total_income": 0,
+			"total_expenses": 300,
+			"current_balance": -300
+		  }],
+		  "pagination": {
+			"current_page": 1,
+			"total_pages": 1,
+			"per_page": 10
+		  }
+		}`, rec.Body.String())
+	})
+
+	t.Run("get all transaction with filters", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions?category=Food&transaction_type=expense&min_amount=50&spender_id=1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 100, "THB", "Food", "expense", "notes", "http://www", 1, "")
+
+		mock.ExpectQuery(`SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction WHERE amount >= $1 AND category = $2 AND transaction_type = $3 AND spender_id = $4 GROUP BY currency ORDER BY currency`).
+			WithArgs(money.Amount(50_00), "Food", "expense", int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).AddRow("THB", 1, 0, 100))
+		mock.ExpectQuery(`SELECT id, date, amount, currency, category, transaction_type, note, image_url, spender_id, reference FROM transaction WHERE amount >= $1 AND category = $2 AND transaction_type = $3 AND spender_id = $4 ORDER BY date DESC, id DESC LIMIT $5 OFFSET $6`).
+			WithArgs(money.Amount(50_00), "Food", "expense", int64(1), 10, 0).
+			WillReturnRows(rows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetAll(c)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get all transaction failed when filter is malformed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions?from=yesterday", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.GetAll(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid from")
 	})
 
+	t.Run("get all transaction failed on database", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'income'), 0), COALESCE(SUM(amount) FILTER (WHERE transaction_type = 'expense'), 0) FROM transaction GROUP BY currency ORDER BY currency`).
+			WillReturnError(assert.AnError)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetAll(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+
+	t.Run("keep currencies apart in the summary", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(sumStmt + sumGroup).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}).
+				AddRow("THB", 2, 0, 300).
+				AddRow("USD", 1, 10, 0))
+		mock.ExpectQuery(lStmt+` ORDER BY date DESC, id DESC LIMIT $1 OFFSET $2`).
+			WithArgs(10, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}))
+
+		err := New(config.FeatureFlag{}, db).GetAll(c)
+
+		assert.NoError(t, err)
+		var got T
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, []Summary{
+			{Currency: "THB", TotalIncome: 0, TotalExpenses: 300_00, CurrentBalance: -300_00},
+			{Currency: "USD", TotalIncome: 10_00, TotalExpenses: 0, CurrentBalance: 10_00},
+		}, got.Summary)
+		assert.Equal(t, 1, got.Pagination.TotalPage)
+	})
 }
 
 func TestCreateTransaction(t *testing.T) {
 	t.Run("create transaction successfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
@@ -90,7 +226,7 @@ func TestCreateTransaction(t *testing.T) {
 		stub := initStub(
 			Transaction{
 				Date:            dt,
-				Amount:          1000,
+				Amount:          1000_00,
 				Category:        "Food",
 				Note:            "Lunch",
 				TransactionType: "expense",
@@ -105,20 +241,26 @@ func TestCreateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
+		mock.ExpectQuery(dupStmt).
+			WithArgs(stub.transaction.SpenderID, stub.transaction.Amount, stub.transaction.Date, "", "expense", "THB").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}))
 		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
 		mock.ExpectQuery(cStmt).
 			WithArgs(
 				stub.transaction.Date,
 				stub.transaction.Amount,
+				"THB",
 				stub.transaction.Category,
 				stub.transaction.TransactionType,
 				stub.transaction.Note,
 				stub.transaction.ImageUrl,
 				stub.transaction.SpenderID,
+				"",
 			).
 			WillReturnRows(row)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
@@ -132,6 +274,7 @@ func TestCreateTransaction(t *testing.T) {
 			"id": 1,
 			"date": "2024-05-11T09:07:29Z",
 			"amount": 1000,
+			"currency": "THB",
 			"category": "Food",
 			"transaction_type": "expense",
 			"note": "Lunch",
@@ -140,30 +283,68 @@ func TestCreateTransaction(t *testing.T) {
 		}`, rec.Body.String())
 
 	})
+	t.Run("create transaction failed when it was already recorded", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+			"date": "2024-05-11T09:07:29Z",
+			"amount": 1000,
+			"category": "Food",
+			"transaction_type": "expense",
+			"spender_id": 1,
+			"reference": " 2024051212345 "
+		}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		dt := time.Date(2024, 05, 11, 9, 07, 0, 0, time.UTC)
+		mock.ExpectQuery(dupStmt).
+			WithArgs(int64(1), money.Amount(1000_00), time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC), "2024051212345", "expense", "THB").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+				AddRow(7, dt, 1000, "THB", "Food", "expense", "", "", 1, "2024051212345"))
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.Equal(t, http.StatusConflict, problem.Status(err))
+		var perr *problem.Error
+		assert.ErrorAs(t, err, &perr)
+		assert.Equal(t, int64(7), perr.Existing.(Transaction).ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 	t.Run("create transaction failed when bad request body", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{ bad request body }`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, nil)
 		err := h.Create(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Contains(t, rec.Body.String(), "invalid character")
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid character")
 	})
 	t.Run("create transaction failed on database (feature toggle is enable) ", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
 			"date": "2024-05-11T09:07:29Z",
 			"amount": 1000,
+			"currency": "THB",
 			"category": "Food",
 			"transaction_type": "expense",
 			"note": "Lunch",
@@ -173,6 +354,7 @@ func TestCreateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -183,8 +365,7 @@ func TestCreateTransaction(t *testing.T) {
 		h := New(cfg, db)
 		err := h.Create(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
 	})
 
 }
@@ -192,6 +373,7 @@ func TestCreateTransaction(t *testing.T) {
 func TestUpdateTransaction(t *testing.T) {
 	t.Run("update transaction successfully", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
@@ -199,7 +381,7 @@ func TestUpdateTransaction(t *testing.T) {
 		stub := initStub(
 			Transaction{
 				Date:            dt,
-				Amount:          1000,
+				Amount:          1000_00,
 				Category:        "Food",
 				Note:            "Lunch",
 				TransactionType: "expense",
@@ -214,6 +396,7 @@ func TestUpdateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
 
@@ -224,11 +407,13 @@ func TestUpdateTransaction(t *testing.T) {
 			WithArgs(
 				stub.transaction.Date,
 				stub.transaction.Amount,
+				"THB",
 				stub.transaction.Category,
 				stub.transaction.TransactionType,
 				stub.transaction.Note,
 				stub.transaction.ImageUrl,
 				stub.transaction.SpenderID,
+				"",
 				1,
 			).WillReturnResult(sqlmock.NewResult(1, 1))
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
@@ -242,6 +427,7 @@ func TestUpdateTransaction(t *testing.T) {
 			"id": 1,
 			"date": "2024-05-11T09:07:29Z",
 			"amount": 1000,
+			"currency": "THB",
 			"category": "Food",
 			"transaction_type": "expense",
 			"note": "Lunch",
@@ -252,6 +438,7 @@ func TestUpdateTransaction(t *testing.T) {
 
 	t.Run("update transaction not found", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
@@ -259,7 +446,7 @@ func TestUpdateTransaction(t *testing.T) {
 		stub := initStub(
 			Transaction{
 				Date:            dt,
-				Amount:          1000,
+				Amount:          1000_00,
 				Category:        "Food",
 				Note:            "Lunch",
 				TransactionType: "expense",
@@ -274,6 +461,7 @@ func TestUpdateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
 
@@ -284,11 +472,13 @@ func TestUpdateTransaction(t *testing.T) {
 			WithArgs(
 				stub.transaction.Date,
 				stub.transaction.Amount,
+				"THB",
 				stub.transaction.Category,
 				stub.transaction.TransactionType,
 				stub.transaction.Note,
 				stub.transaction.ImageUrl,
 				stub.transaction.SpenderID,
+				"",
 				1,
 			).WillReturnResult(sqlmock.NewResult(0, 0))
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
@@ -296,17 +486,18 @@ func TestUpdateTransaction(t *testing.T) {
 		h := New(cfg, db)
 		err := h.Update(c)
 
-		assert.Nil(t, err)
-		assert.Equal(t, http.StatusNotFound, rec.Code)
-		assert.Equal(t, "\"transaction not found\"\n", rec.Body.String())
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+		assert.EqualError(t, err, "transaction not found")
 	})
 	t.Run("update transaction failed on database (feature toggle is enable) ", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
 			"date": "2024-05-11T09:07:29Z",
 			"amount": 1000,
+			"currency": "THB",
 			"category": "Food",
 			"transaction_type": "expense",
 			"note": "Lunch",
@@ -316,6 +507,7 @@ func TestUpdateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
 
@@ -328,18 +520,19 @@ func TestUpdateTransaction(t *testing.T) {
 		h := New(cfg, db)
 		err := h.Update(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
 	})
 
 	t.Run("update transaction failed when bad request body", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{ bad request body }`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 		c.SetParamNames("id")
 		c.SetParamValues("1")
@@ -347,19 +540,20 @@ func TestUpdateTransaction(t *testing.T) {
 		h := New(cfg, nil)
 		err := h.Update(c)
 
-		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Contains(t, rec.Body.String(), "invalid character")
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid character")
 	})
 
 	t.Run("update transaction failed when bad path param body", func(t *testing.T) {
 		e := echo.New()
+		e.Validator = validate.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{ bad request body }`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 		c.SetParamNames("id")
 		c.SetParamValues("noneint")
@@ -367,29 +561,623 @@ func TestUpdateTransaction(t *testing.T) {
 		h := New(cfg, nil)
 		err := h.Update(c)
 
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid syntax")
+	})
+
+}
+
+func TestGetTransactionByID(t *testing.T) {
+	t.Run("get transaction successfully", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 1000, "THB", "Food", "expense", "Lunch", "https://example.com/image1.jpg", 1, "")
+		mock.ExpectQuery(gStmt).WithArgs(int64(1)).WillReturnRows(rows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetByID(c)
+
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Contains(t, rec.Body.String(), "invalid syntax")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 1,
+			"date": "2024-05-11T09:07:29Z",
+			"amount": 1000,
+			"currency": "THB",
+			"category": "Food",
+			"transaction_type": "expense",
+			"note": "Lunch",
+			"image_url": "https://example.com/image1.jpg",
+			"spender_id": 1
+		}`, rec.Body.String())
 	})
 
+	t.Run("get transaction not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("99")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(gStmt).WithArgs(int64(99)).WillReturnError(sql.ErrNoRows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	t.Run("get transaction failed when bad path param", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("noneint")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.GetByID(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("get transaction failed on database", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(gStmt).WithArgs(int64(1)).WillReturnError(assert.AnError)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetByID(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
 }
 
-func TestGetSummary(t *testing.T) {
-	t.Run("update transaction successfully", func(t *testing.T) {
+func TestDeleteTransaction(t *testing.T) {
+	t.Run("delete transaction successfully", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"sum"}).
-			AddRow(300)
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		mock.ExpectQuery(`SELECT SUM(amount) FROM transaction WHERE spender_id = $1 AND transaction_type = $2`).
-			WithArgs(1, "expense").
-			WillReturnRows(rows)
+		h := New(config.FeatureFlag{}, db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("delete transaction not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Delete(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	t.Run("delete transaction failed when bad path param", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("noneint")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Delete(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+	})
+
+	t.Run("delete transaction failed on database", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(dStmt).WithArgs(int64(1)).WillReturnError(assert.AnError)
 
 		h := New(config.FeatureFlag{}, db)
-		got, err := h.GetSummary(1, "expense")
+		err := h.Delete(c)
+
+		assert.Equal(t, http.StatusInternalServerError, problem.Status(err))
+	})
+}
+
+func TestPatchTransaction(t *testing.T) {
+	dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+	existing := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+			AddRow(1, dt, 1000, "THB", "Food", "expense", "Lunch", "https://example.com/image1.jpg", 1, "")
+	}
+
+	t.Run("patch only the supplied fields", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"amount": 250, "note": null}`))
+		req.Header.Set(echo.HeaderContentType, patch.MIMEApplicationMergePatchJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnRows(existing())
+		mock.ExpectExec(uStmt).
+			WithArgs(dt, money.Amount(250_00), "THB", "Food", "expense", "", "https://example.com/image1.jpg", int64(1), "", int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Patch(c)
 
 		assert.NoError(t, err)
-		assert.Equal(t, 300.0, got)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 1,
+			"date": "2024-05-11T09:07:29Z",
+			"amount": 250,
+			"currency": "THB",
+			"category": "Food",
+			"transaction_type": "expense",
+			"note": "",
+			"image_url": "https://example.com/image1.jpg",
+			"spender_id": 1
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch transaction not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"amount": 250}`))
+		req.Header.Set(echo.HeaderContentType, patch.MIMEApplicationMergePatchJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Patch(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch transaction failed when field is unknown", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"colour": "red"}`))
+		req.Header.Set(echo.HeaderContentType, patch.MIMEApplicationMergePatchJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).WillReturnRows(existing())
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Patch(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "unknown field")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch transaction failed when bad request body", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{ bad request body }`))
+		req.Header.Set(echo.HeaderContentType, patch.MIMEApplicationMergePatchJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Patch(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "invalid character")
+	})
+
+	t.Run("patch transaction failed when content type is not json", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`amount=250`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Patch(c)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, problem.Status(err))
+	})
+}
+
+func TestTransactionAmountValidation(t *testing.T) {
+	bodies := map[string]string{
+		"negative amount":            `{"date": "2024-05-11T09:07:29Z", "amount": -10, "category": "Food", "transaction_type": "expense", "spender_id": 1}`,
+		"too many fractional digits": `{"date": "2024-05-11T09:07:29Z", "amount": 10.005, "category": "Food", "transaction_type": "expense", "spender_id": 1}`,
+		"amount above decimal(10,2)": `{"date": "2024-05-11T09:07:29Z", "amount": 100000000, "category": "Food", "transaction_type": "expense", "spender_id": 1}`,
+		"unknown currency":           `{"date": "2024-05-11T09:07:29Z", "amount": 10, "currency": "XYZ", "category": "Food", "transaction_type": "expense", "spender_id": 1}`,
+	}
+	for name, body := range bodies {
+		t.Run("create transaction failed when "+name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = validate.New()
+			defer e.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			auth.SetIdentity(c, admin)
+
+			h := New(config.FeatureFlag{}, nil)
+			err := h.Create(c)
+
+			assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		})
+	}
+}
+
+func TestTransactionPayloadValidation(t *testing.T) {
+	t.Run("create transaction reports every invalid field", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount": 10, "category": "", "transaction_type": "foo"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Create(c)
+
+		problem.ErrorHandler(err, c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, problem.MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.JSONEq(t, `{
+			"type": "/problems/validation",
+			"title": "Bad Request",
+			"status": 400,
+			"detail": "validation failed",
+			"instance": "/",
+			"errors": [
+				{"field": "date", "rule": "required", "message": "date is required"},
+				{"field": "category", "rule": "required", "message": "category is required"},
+				{"field": "transaction_type", "rule": "oneof", "message": "transaction_type must be one of income, expense"},
+				{"field": "spender_id", "rule": "required", "message": "spender_id is required"}
+			]
+		}`, rec.Body.String())
+	})
+
+	t.Run("update transaction rejects invalid payload", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"date": "2024-05-11T09:07:29Z", "amount": 10, "category": "Food", "transaction_type": "expense"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Update(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "spender_id is required")
+	})
+
+	t.Run("patch transaction rejects a result that is no longer valid", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = validate.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"category": null}`))
+		req.Header.Set(echo.HeaderContentType, patch.MIMEApplicationMergePatchJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+				AddRow(1, dt, 1000, "THB", "Food", "expense", "Lunch", "", 1, ""))
+		mock.ExpectRollback()
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Patch(c)
+
+		assert.Equal(t, http.StatusBadRequest, problem.Status(err))
+		assert.ErrorContains(t, err, "category is required")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTransactionOwnership(t *testing.T) {
+	newContext := func(method, target, body string, id *auth.Identity) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = validate.New()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if id != nil {
+			auth.SetIdentity(c, *id)
+		}
+		return c, rec
+	}
+	other := `{"date": "2024-05-11T09:07:29Z", "amount": 10, "category": "Food", "transaction_type": "expense", "spender_id": 2}`
+
+	t.Run("list only the caller's transactions", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "/transactions", "", &spender)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(sumStmt + ` WHERE spender_id = $1` + sumGroup).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "income", "expense"}))
+		mock.ExpectQuery(lStmt+` WHERE spender_id = $1 ORDER BY date DESC, id DESC LIMIT $2 OFFSET $3`).WithArgs(int64(1), 10, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}))
+
+		err := New(config.FeatureFlag{}, db).GetAll(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("forbid listing another spender's transactions", func(t *testing.T) {
+		c, _ := newContext(http.MethodGet, "/transactions?spender_id=2", "", &spender)
+
+		err := New(config.FeatureFlag{}, nil).GetAll(c)
+
+		assert.Equal(t, http.StatusForbidden, problem.Status(err))
+	})
+
+	t.Run("hide another spender's transaction", func(t *testing.T) {
+		c, _ := newContext(http.MethodGet, "/", "", &spender)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(gStmt).WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+				AddRow(1, time.Now(), 1000, "THB", "Food", "expense", "", "", 2, ""))
+
+		err := New(config.FeatureFlag{}, db).GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	t.Run("forbid creating for another spender", func(t *testing.T) {
+		c, _ := newContext(http.MethodPost, "/", other, &spender)
+
+		err := New(config.FeatureFlag{}, nil).Create(c)
+
+		assert.Equal(t, http.StatusForbidden, problem.Status(err))
+	})
+
+	t.Run("update only the caller's transaction", func(t *testing.T) {
+		c, _ := newContext(http.MethodPut, "/", strings.Replace(other, `"spender_id": 2`, `"spender_id": 1`, 1), &spender)
+		c.SetParamNames("id")
+		c.SetParamValues("5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(uOwnStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete only the caller's transaction", func(t *testing.T) {
+		c, rec := newContext(http.MethodDelete, "/", "", &spender)
+		c.SetParamNames("id")
+		c.SetParamValues("5")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(dOwnStmt).WithArgs(int64(5), int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(config.FeatureFlag{}, db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("reject caller without identity", func(t *testing.T) {
+		c, _ := newContext(http.MethodGet, "/transactions", "", nil)
+
+		err := New(config.FeatureFlag{}, nil).GetAll(c)
+
+		assert.Equal(t, http.StatusUnauthorized, problem.Status(err))
+	})
+}
+
+func TestUnknownSpender(t *testing.T) {
+	newContext := func(method, contentType, body string) echo.Context {
+		e := echo.New()
+		e.Validator = validate.New()
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		c := e.NewContext(req, httptest.NewRecorder())
+		auth.SetIdentity(c, admin)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		return c
+	}
+	dt := time.Date(2024, 05, 11, 9, 07, 29, 0, time.UTC)
+	body := `{"date": "2024-05-11T09:07:29Z", "amount": 10, "category": "Food", "transaction_type": "expense", "spender_id": 9}`
+	fkey := &pq.Error{Code: errForeignKey}
+
+	t.Run("create transaction failed when the spender does not exist", func(t *testing.T) {
+		c := newContext(http.MethodPost, echo.MIMEApplicationJSON, body)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(dupStmt).WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}))
+		mock.ExpectQuery(cStmt).WillReturnError(fkey)
+
+		err := New(config.FeatureFlag{}, db).Create(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.ErrorContains(t, err, "spender 9 does not exist")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update transaction failed when the spender does not exist", func(t *testing.T) {
+		c := newContext(http.MethodPut, echo.MIMEApplicationJSON, body)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(uStmt).WillReturnError(fkey)
+
+		err := New(config.FeatureFlag{}, db).Update(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("patch transaction failed when the spender does not exist", func(t *testing.T) {
+		c := newContext(http.MethodPatch, patch.MIMEApplicationMergePatchJSON, `{"spender_id": 9}`)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery(gStmt + " FOR UPDATE").WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "currency", "category", "transaction_type", "note", "image_url", "spender_id", "reference"}).
+				AddRow(1, dt, 1000, "THB", "Food", "expense", "", "", 1, ""))
+		mock.ExpectExec(uStmt).WillReturnError(fkey)
+		mock.ExpectRollback()
+
+		err := New(config.FeatureFlag{}, db).Patch(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, problem.Status(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
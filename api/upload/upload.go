@@ -0,0 +1,199 @@
+package upload
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/queue"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// KindProcess is the job kind processing one upload.
+const KindProcess = "upload.process"
+
+// Upload states, polled by the mobile app.
+const (
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusDone       = "done"
+	StatusFailed     = "failed"
+)
+
+// Upload tracks a stored slip through its processing.
+type Upload struct {
+	ID          int64     `json:"id"`
+	SpenderID   *int64    `json:"spender_id"`
+	Filename    string    `json:"filename"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Status      string    `json:"status"`
+	DraftID     *int64    `json:"draft_id"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Drafter reads a draft transaction from a stored slip, see draft. It
+// returns 0 when no draft was made.
+type Drafter interface {
+	Draft(ctx context.Context, spender *int64, slip eslip.Result, r io.Reader) (int64, error)
+}
+
+type handler struct {
+	db     *sql.DB
+	jobs   *queue.Queue
+	store  storage.BlobStore
+	drafts Drafter
+}
+
+func New(db *sql.DB, jobs *queue.Queue, store storage.BlobStore, drafts Drafter) *handler {
+	return &handler{db, jobs, store, drafts}
+}
+
+type payload struct {
+	UploadID int64 `json:"upload_id"`
+}
+
+const (
+	// fStmt finds an earlier upload of the same slip by the same spender,
+	// failed ones may be uploaded again.
+	fStmt = `SELECT id FROM upload WHERE spender_id IS NOT DISTINCT FROM $1 AND sha256 = $2 AND status <> 'failed' ORDER BY id LIMIT 1`
+	cStmt = `INSERT INTO upload (spender_id, filename, storage_key, content_type, size, sha256) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;`
+	gStmt = `SELECT id, spender_id, filename, storage_key, content_type, size, sha256, status, draft_id, error, created_at, updated_at FROM upload WHERE id = $1`
+	sStmt = `UPDATE upload SET status = $2, error = $3, updated_at = now() WHERE id = $1;`
+	dStmt = `UPDATE upload SET status = 'done', draft_id = $2, error = '', updated_at = now() WHERE id = $1;`
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUpload(row scanner, u *Upload) error {
+	return row.Scan(&u.ID, &u.SpenderID, &u.Filename, &u.Key, &u.ContentType, &u.Size, &u.SHA256,
+		&u.Status, &u.DraftID, &u.Error, &u.CreatedAt, &u.UpdatedAt)
+}
+
+// Process implements eslip.Processor. The upload and its job are recorded
+// in one transaction so no upload is left without a job.
+func (h handler) Process(ctx context.Context, spender *int64, slip eslip.Result) (int64, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, fStmt, spender, slip.SHA256).Scan(&id)
+	if err == nil {
+		return id, eslip.ErrDuplicate
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, cStmt, spender, slip.Filename, slip.Key, slip.ContentType, slip.Size, slip.SHA256).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := h.jobs.Enqueue(ctx, tx, KindProcess, payload{UploadID: id}); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Work is the queue.Handler of KindProcess jobs: it reads the stored slip
+// back and drafts a transaction from it. The upload fails with the job's
+// last attempt.
+func (h handler) Work(ctx context.Context, job queue.Job) error {
+	var p payload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return err
+	}
+
+	err := h.work(ctx, p.UploadID)
+	if err != nil {
+		// A deleted upload or slip will not come back, so stop retrying.
+		gone := errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrNotFound)
+		status := StatusQueued
+		if job.Final() || gone {
+			status = StatusFailed
+		}
+		if _, serr := h.db.ExecContext(ctx, sStmt, p.UploadID, status, err.Error()); serr != nil {
+			return errors.Join(err, serr)
+		}
+		if gone {
+			return fmt.Errorf("%w: %w", queue.ErrPermanent, err)
+		}
+	}
+	return err
+}
+
+func (h handler) work(ctx context.Context, id int64) error {
+	var u Upload
+	err := scanUpload(h.db.QueryRowContext(ctx, gStmt, id), &u)
+	if err != nil {
+		return fmt.Errorf("load upload %d: %w", id, err)
+	}
+	if _, err := h.db.ExecContext(ctx, sStmt, id, StatusProcessing, ""); err != nil {
+		return err
+	}
+
+	r, err := h.store.Get(ctx, u.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	slip := eslip.Result{Filename: u.Filename, Key: u.Key, ContentType: u.ContentType, Size: u.Size, SHA256: u.SHA256}
+	draft, err := h.drafts.Draft(ctx, u.SpenderID, slip, r)
+	if err != nil {
+		return err
+	}
+
+	var draftID *int64
+	if draft != 0 {
+		draftID = &draft
+	}
+	_, err = h.db.ExecContext(ctx, dStmt, id, draftID)
+	return err
+}
+
+// GetByID reports the progress of an upload. Uploads of other spenders are
+// reported as not found.
+func (h handler) GetByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return problem.BadRequest(err)
+	}
+	identity, ok := auth.FromContext(c)
+	if !ok {
+		return problem.Unauthorized("missing identity")
+	}
+
+	var u Upload
+	err = scanUpload(h.db.QueryRowContext(c.Request().Context(), gStmt, id), &u)
+	if errors.Is(err, sql.ErrNoRows) {
+		return problem.NotFound("upload not found")
+	}
+	if err != nil {
+		return err
+	}
+	if own := identity.SpenderScope(); own != nil && (u.SpenderID == nil || *u.SpenderID != *own) {
+		return problem.NotFound("upload not found")
+	}
+
+	return c.JSON(http.StatusOK, u)
+}
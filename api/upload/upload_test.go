@@ -0,0 +1,236 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/problem"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/queue"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/storage"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/validate"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeDrafter returns a fixed draft, or its error, for any slip.
+type fakeDrafter struct {
+	draft   int64
+	err     error
+	slip    eslip.Result
+	content string
+}
+
+func (f *fakeDrafter) Draft(_ context.Context, _ *int64, slip eslip.Result, r io.Reader) (int64, error) {
+	b, _ := io.ReadAll(r)
+	f.slip, f.content = slip, string(b)
+	return f.draft, f.err
+}
+
+var (
+	spender = auth.Identity{SpenderID: 1, Role: auth.RoleSpender}
+	admin   = auth.Identity{Role: auth.RoleAdmin}
+	at      = time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+	slip    = eslip.Result{Filename: "slip.png", Key: "eslips/abc.png", ContentType: "image/png", Size: 4, SHA256: "abc"}
+	columns = []string{"id", "spender_id", "filename", "storage_key", "content_type", "size", "sha256", "status", "draft_id", "error", "created_at", "updated_at"}
+	jobCfg  = config.Queue{MaxAttempts: 3}
+)
+
+func uploadRow(spender any, status string) *sqlmock.Rows {
+	return sqlmock.NewRows(columns).AddRow(7, spender, slip.Filename, slip.Key, slip.ContentType, slip.Size, slip.SHA256, status, nil, "", at, at)
+}
+
+func newHandler(t *testing.T, drafts Drafter) (*handler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, _ := storage.NewLocal(t.TempDir())
+	store.Put(context.Background(), slip.Key, strings.NewReader("slip"), slip.Size, slip.ContentType)
+	return New(db, queue.New(db, jobCfg, zap.NewNop()), store, drafts), mock
+}
+
+func job(attempts int) queue.Job {
+	return queue.Job{ID: 3, Kind: KindProcess, Payload: []byte(`{"upload_id":7}`), Attempts: attempts, MaxAttempts: 3}
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("queue a new slip", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectBegin()
+		mock.ExpectQuery(fStmt).WithArgs(int64(1), slip.SHA256).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(cStmt).WithArgs(int64(1), slip.Filename, slip.Key, slip.ContentType, slip.Size, slip.SHA256).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectQuery(`INSERT INTO job (kind, payload, max_attempts) VALUES ($1, $2, $3) RETURNING id;`).
+			WithArgs(KindProcess, `{"upload_id":7}`, 3).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectCommit()
+		id := int64(1)
+
+		got, err := h.Process(context.Background(), &id, slip)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("return the earlier upload of the same slip", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectBegin()
+		mock.ExpectQuery(fStmt).WithArgs(nil, slip.SHA256).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectRollback()
+
+		got, err := h.Process(context.Background(), nil, slip)
+
+		assert.ErrorIs(t, err, eslip.ErrDuplicate)
+		assert.Equal(t, int64(4), got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWork(t *testing.T) {
+	t.Run("record the draft read from the slip", func(t *testing.T) {
+		drafts := &fakeDrafter{draft: 5}
+		h, mock := newHandler(t, drafts)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(1, StatusQueued))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusProcessing, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(dStmt).WithArgs(int64(7), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := h.Work(context.Background(), job(1))
+
+		assert.NoError(t, err)
+		assert.Equal(t, slip, drafts.slip)
+		assert.Equal(t, "slip", drafts.content)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("finish without a draft", func(t *testing.T) {
+		h, mock := newHandler(t, &fakeDrafter{})
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(nil, StatusQueued))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusProcessing, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(dStmt).WithArgs(int64(7), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := h.Work(context.Background(), job(1))
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("queue the upload again for a retry", func(t *testing.T) {
+		h, mock := newHandler(t, &fakeDrafter{err: assert.AnError})
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(1, StatusQueued))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusProcessing, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusQueued, assert.AnError.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := h.Work(context.Background(), job(2))
+
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("fail the upload with the last attempt", func(t *testing.T) {
+		h, mock := newHandler(t, &fakeDrafter{err: assert.AnError})
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(1, StatusQueued))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusProcessing, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusFailed, assert.AnError.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := h.Work(context.Background(), job(3))
+
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("fail the upload when its slip is gone", func(t *testing.T) {
+		h, mock := newHandler(t, &fakeDrafter{})
+		row := sqlmock.NewRows(columns).AddRow(7, 1, slip.Filename, "eslips/gone.png", slip.ContentType, slip.Size, slip.SHA256, StatusQueued, nil, "", at, at)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(row)
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusProcessing, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusFailed, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := h.Work(context.Background(), job(1))
+
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.ErrorIs(t, err, queue.ErrPermanent)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("give up on a deleted upload", func(t *testing.T) {
+		h, mock := newHandler(t, &fakeDrafter{})
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectExec(sStmt).WithArgs(int64(7), StatusFailed, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := h.Work(context.Background(), job(1))
+
+		assert.ErrorIs(t, err, queue.ErrPermanent)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func newContext(identity auth.Identity) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validate.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	auth.SetIdentity(c, identity)
+	return c, rec
+}
+
+func TestGetByID(t *testing.T) {
+	t.Run("return own upload", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(1, StatusProcessing))
+		c, rec := newContext(spender)
+
+		err := h.GetByID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 7, "spender_id": 1, "filename": "slip.png", "key": "eslips/abc.png", "content_type": "image/png",
+			"size": 4, "sha256": "abc", "status": "processing", "draft_id": null,
+			"created_at": "2024-05-12T00:00:00Z", "updated_at": "2024-05-12T00:00:00Z"
+		}`, rec.Body.String())
+	})
+
+	t.Run("return any upload to admins", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(2, StatusDone))
+		c, rec := newContext(admin)
+
+		err := h.GetByID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("hide upload of another spender", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(uploadRow(2, StatusDone))
+		c, _ := newContext(spender)
+
+		err := h.GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+
+	t.Run("report a missing upload", func(t *testing.T) {
+		h, mock := newHandler(t, nil)
+		mock.ExpectQuery(gStmt).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows(columns))
+		c, _ := newContext(admin)
+
+		err := h.GetByID(c)
+
+		assert.Equal(t, http.StatusNotFound, problem.Status(err))
+	})
+}
@@ -0,0 +1,155 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes one rule a request field failed. Field uses the JSON
+// name of the field so clients can map errors back to their payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is returned by Validator.Validate and renders as the JSON body of
+// every validation failure.
+type Error struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Message)
+	}
+	return e.Message + ": " + strings.Join(msgs, ", ")
+}
+
+// Validator implements echo.Validator on top of the declarative `validate`
+// struct tags.
+type Validator struct {
+	v *validator.Validate
+}
+
+func New() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	// currency accepts ISO 4217 codes, already upper-cased.
+	v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		code, err := money.NormalizeCurrency(fl.Field().String())
+		return err == nil && code == fl.Field().String()
+	})
+
+	// amount accepts what a non-negative DECIMAL(10,2) column can hold.
+	v.RegisterValidation("amount", func(fl validator.FieldLevel) bool {
+		a := money.Amount(fl.Field().Int())
+		return a >= 0 && a <= money.Max
+	})
+
+	// maxbytes limits the length of a string in bytes rather than
+	// characters, like bcrypt does passwords.
+	v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		n, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= n
+	})
+
+	return &Validator{v}
+}
+
+// Validate checks a struct, or each element of a slice of structs, and
+// returns an *Error listing every failed rule.
+func (cv *Validator) Validate(i any) error {
+	rv := reflect.Indirect(reflect.ValueOf(i))
+	if rv.Kind() != reflect.Slice {
+		return cv.validate(i, "")
+	}
+
+	var all []FieldError
+	for n := 0; n < rv.Len(); n++ {
+		err := cv.validate(rv.Index(n).Interface(), fmt.Sprintf("[%d].", n))
+		var verr *Error
+		if errors.As(err, &verr) {
+			all = append(all, verr.Errors...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(all) > 0 {
+		return &Error{Message: "validation failed", Errors: all}
+	}
+	return nil
+}
+
+func (cv *Validator) validate(i any, prefix string) error {
+	err := cv.v.Struct(i)
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		name := prefix + fieldName(fe)
+		fields = append(fields, FieldError{
+			Field:   name,
+			Rule:    fe.Tag(),
+			Message: message(name, fe),
+		})
+	}
+	return &Error{Message: "validation failed", Errors: fields}
+}
+
+// fieldName drops the root struct name from the namespace, "Transaction.date"
+// becomes "date".
+func fieldName(fe validator.FieldError) string {
+	_, name, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return name
+}
+
+func message(name string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return name + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", name, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", name, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", name, fe.Param())
+	case "maxbytes":
+		return fmt.Sprintf("%s must be at most %s bytes", name, fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", name, fe.Param())
+	case "email":
+		return name + " must be a valid email address"
+	case "currency":
+		return name + " must be an ISO 4217 currency code"
+	case "amount":
+		return fmt.Sprintf("%s must be between 0.00 and %s", name, money.Max)
+	case "datetime":
+		return fmt.Sprintf("%s must be formatted as %s", name, fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", name, fe.Tag())
+	}
+}
@@ -0,0 +1,89 @@
+package validate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+type payload struct {
+	Date     time.Time    `json:"date" validate:"required"`
+	Amount   money.Amount `json:"amount" validate:"amount"`
+	Currency string       `json:"currency" validate:"currency"`
+	Kind     string       `json:"kind" validate:"required,oneof=income expense"`
+	Email    string       `json:"email" validate:"omitempty,email"`
+	Secret   string       `json:"secret" validate:"maxbytes=6"`
+	Ignored  string       `json:"-" validate:"max=1"`
+}
+
+func valid() payload {
+	return payload{
+		Date:     time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC),
+		Amount:   100_00,
+		Currency: "THB",
+		Kind:     "expense",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v := New()
+
+	t.Run("accept a valid struct", func(t *testing.T) {
+		assert.NoError(t, v.Validate(valid()))
+	})
+
+	t.Run("report every failed field by json name", func(t *testing.T) {
+		p := payload{Amount: -1, Currency: "thb", Kind: "foo", Email: "not-an-email"}
+
+		err := v.Validate(p)
+
+		var verr *Error
+		assert.ErrorAs(t, err, &verr)
+		assert.Equal(t, "validation failed", verr.Message)
+		assert.Equal(t, []FieldError{
+			{Field: "date", Rule: "required", Message: "date is required"},
+			{Field: "amount", Rule: "amount", Message: "amount must be between 0.00 and 99999999.99"},
+			{Field: "currency", Rule: "currency", Message: "currency must be an ISO 4217 currency code"},
+			{Field: "kind", Rule: "oneof", Message: "kind must be one of income, expense"},
+			{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+		}, verr.Errors[:5])
+	})
+
+	t.Run("reject amounts above the column precision", func(t *testing.T) {
+		p := valid()
+		p.Amount = money.Max + 1
+
+		assert.Error(t, v.Validate(p))
+	})
+
+	t.Run("count bytes rather than characters", func(t *testing.T) {
+		p := valid()
+		p.Secret = "กขค"
+
+		err := v.Validate(p)
+
+		var verr *Error
+		assert.ErrorAs(t, err, &verr)
+		assert.Equal(t, []FieldError{{Field: "secret", Rule: "maxbytes", Message: "secret must be at most 6 bytes"}}, verr.Errors)
+	})
+
+	t.Run("prefix fields with their index when validating a slice", func(t *testing.T) {
+		bad := valid()
+		bad.Kind = ""
+
+		err := v.Validate([]payload{valid(), bad})
+
+		var verr *Error
+		assert.ErrorAs(t, err, &verr)
+		assert.Equal(t, "[1].kind", verr.Errors[0].Field)
+	})
+
+	t.Run("error message lists field messages", func(t *testing.T) {
+		p := valid()
+		p.Kind = ""
+
+		assert.EqualError(t, v.Validate(p), "validation failed: kind is required")
+	})
+}
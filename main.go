@@ -35,6 +35,13 @@ func main() {
 
 	e := api.New(db, cfg, logger)
 
+	work, stopWork := context.WithCancel(context.Background())
+	worked := make(chan struct{})
+	go func() {
+		defer close(worked)
+		e.Work(work)
+	}()
+
 	go func() { // comment here to simulate slow endpoint then Ctrl+C to stop the server
 		if err := e.Start(":" + cfg.Server.Port); err != nil && err != http.ErrServerClosed {
 			logger.Fatal("shutting down the server:", zap.Error(err))
@@ -54,5 +61,13 @@ func main() {
 	if err := e.Shutdown(ctx); err != nil {
 		logger.Fatal("shutting down the server:", zap.Error(err))
 	}
+
+	// running jobs finish within their lease, or are picked up again after it
+	stopWork()
+	select {
+	case <-worked:
+	case <-ctx.Done():
+		logger.Warn("jobs still running at shutdown")
+	}
 	logger.Info("server shutdown gracefully")
 }
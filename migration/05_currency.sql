@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "transaction"
+ADD COLUMN "currency" CHAR(3) NOT NULL DEFAULT 'THB';
+
+ALTER TABLE "spender"
+ADD COLUMN "base_currency" CHAR(3) NOT NULL DEFAULT 'THB';
+
+CREATE TABLE IF NOT EXISTS "exchange_rate" (
+  id SERIAL PRIMARY KEY,
+  from_currency CHAR(3) NOT NULL,
+  to_currency CHAR(3) NOT NULL,
+  rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+  effective_date DATE NOT NULL,
+  UNIQUE (from_currency, to_currency, effective_date)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "exchange_rate";
+
+ALTER TABLE "spender" DROP COLUMN "base_currency";
+
+ALTER TABLE "transaction" DROP COLUMN "currency";
+-- +goose StatementEnd
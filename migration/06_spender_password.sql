@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "spender"
+ADD COLUMN "password_hash" TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "spender" DROP COLUMN "password_hash";
+-- +goose StatementEnd
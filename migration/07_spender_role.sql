@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "spender"
+ADD COLUMN "role" TEXT NOT NULL DEFAULT 'spender' CHECK ("role" IN ('admin', 'spender'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "spender" DROP COLUMN "role";
+-- +goose StatementEnd
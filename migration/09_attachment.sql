@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "attachment" (
+  id SERIAL PRIMARY KEY,
+  transaction_id INT NOT NULL REFERENCES "transaction" (id) ON DELETE CASCADE,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  sha256 TEXT NOT NULL,
+  uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  UNIQUE (transaction_id, sha256)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "attachment";
+-- +goose StatementEnd
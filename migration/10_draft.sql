@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "draft" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  sha256 TEXT NOT NULL,
+  amount DECIMAL(10,2),
+  date TIMESTAMP WITH TIME ZONE,
+  merchant TEXT NOT NULL DEFAULT '',
+  amount_confidence REAL NOT NULL DEFAULT 0,
+  date_confidence REAL NOT NULL DEFAULT 0,
+  merchant_confidence REAL NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed')),
+  transaction_id INT REFERENCES "transaction" (id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "draft";
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "draft"
+ADD COLUMN "bank" TEXT NOT NULL DEFAULT '',
+ADD COLUMN "reference" TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS draft_reference_idx ON "draft" (bank, reference) WHERE reference <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS draft_reference_idx;
+ALTER TABLE "draft"
+DROP COLUMN "bank",
+DROP COLUMN "reference";
+-- +goose StatementEnd
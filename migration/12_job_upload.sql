@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "job" (
+  id BIGSERIAL PRIMARY KEY,
+  kind TEXT NOT NULL,
+  payload JSONB NOT NULL DEFAULT '{}',
+  status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'dead')),
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL,
+  run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  locked_until TIMESTAMP WITH TIME ZONE,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS job_pending_idx ON "job" (run_at, id) WHERE status IN ('queued', 'running');
+
+CREATE TABLE IF NOT EXISTS "upload" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT,
+  filename TEXT NOT NULL DEFAULT '',
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  sha256 TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'processing', 'done', 'failed')),
+  draft_id INT REFERENCES "draft" (id) ON DELETE SET NULL,
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "upload";
+DROP TABLE IF EXISTS "job";
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "transaction"
+ADD COLUMN "reference" TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS transaction_duplicate_idx ON "transaction" (spender_id, amount);
+CREATE INDEX IF NOT EXISTS upload_sha256_idx ON "upload" (sha256);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS upload_sha256_idx;
+DROP INDEX IF EXISTS transaction_duplicate_idx;
+ALTER TABLE "transaction"
+DROP COLUMN "reference";
+-- +goose StatementEnd
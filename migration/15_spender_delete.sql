@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "spender"
+ADD COLUMN "archived_at" TIMESTAMP WITH TIME ZONE;
+-- NOT VALID keeps transactions recorded for missing spenders from blocking
+-- the migration, new and updated rows are still checked.
+ALTER TABLE "transaction"
+ADD CONSTRAINT transaction_spender_id_fkey FOREIGN KEY (spender_id) REFERENCES "spender" (id) NOT VALID;
+CREATE INDEX IF NOT EXISTS transaction_spender_id_idx ON "transaction" (spender_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transaction_spender_id_idx;
+ALTER TABLE "transaction"
+DROP CONSTRAINT IF EXISTS transaction_spender_id_fkey;
+ALTER TABLE "spender"
+DROP COLUMN "archived_at";
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE "spender" SET email = lower(trim(email));
+-- spenders signed up twice under one email before it was unique keep the
+-- oldest account, the others are archived with their data kept
+UPDATE "spender" s SET archived_at = now()
+WHERE s.archived_at IS NULL
+AND EXISTS (SELECT 1 FROM "spender" o WHERE o.email = s.email AND o.archived_at IS NULL AND o.id < s.id);
+-- archived spenders give their email up, it may sign up again
+CREATE UNIQUE INDEX IF NOT EXISTS spender_email_idx ON "spender" (lower(email)) WHERE archived_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS spender_email_idx;
+-- +goose StatementEnd